@@ -2,6 +2,7 @@ package game
 
 import (
 	"crypto/rand"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
@@ -17,21 +18,36 @@ var (
 )
 
 type Client struct {
+	// Protocol implementation
 	Proto encoding.Client
-	addr  string
+	// Protocol name announced in connection preamble, no preamble
+	// is sent if empty
+	ProtoName string
+	// TLS configuration, connection is not encrypted if nil
+	TLSConfig *tls.Config
+
+	addr string
 }
 
 func NewClient(addr string) *Client {
 	return &Client{Proto: defaultProto, addr: addr}
 }
 
+// Play plays a single game. Errors reported by the server are returned
+// as *lottery.ServerError
 func (cli *Client) Play(fee uint64) (*lottery.Response, error) {
-	c, err := net.Dial("tcp", cli.addr)
+	c, err := cli.dial()
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to server: %s", err)
 	}
 	defer c.Close()
 
+	if cli.ProtoName != "" {
+		if err = encoding.WritePreamble(c, cli.ProtoName); err != nil {
+			return nil, fmt.Errorf("failed to send preamble: %s", err)
+		}
+	}
+
 	req, err := genInitRequest(fee)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create initial request: %s", err)
@@ -53,6 +69,12 @@ func (cli *Client) Play(fee uint64) (*lottery.Response, error) {
 
 	log.Printf("info: %s response: %s", addr, resp.String())
 
+	if resp.Type == lottery.Error {
+		return nil, resp.Err()
+	}
+	if err = checkUUID(req, resp); err != nil {
+		return nil, err
+	}
 	if resp.Type != lottery.Bonus {
 		return resp, nil
 	}
@@ -69,9 +91,31 @@ func (cli *Client) Play(fee uint64) (*lottery.Response, error) {
 
 	log.Printf("info: %s response: %s", addr, resp.String())
 
+	if resp.Type == lottery.Error {
+		return nil, resp.Err()
+	}
+	if err = checkUUID(req, resp); err != nil {
+		return nil, err
+	}
 	return resp, nil
 }
 
+// checkUUID makes sure the response is sent for the request. Only protocols
+// binding responses to requests, like encoding/signed, set response UUID
+func checkUUID(req *lottery.Request, resp *lottery.Response) error {
+	if resp.UUID != uuid.Nil && resp.UUID != req.UUID {
+		return fmt.Errorf("response is sent for another request: %s", resp.UUID)
+	}
+	return nil
+}
+
+func (cli *Client) dial() (net.Conn, error) {
+	if cli.TLSConfig == nil {
+		return net.Dial("tcp", cli.addr)
+	}
+	return tls.Dial("tcp", cli.addr, cli.TLSConfig)
+}
+
 func genInitRequest(fee uint64) (*lottery.Request, error) {
 	var err error
 	req := &lottery.Request{Fee: fee}
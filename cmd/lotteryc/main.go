@@ -2,37 +2,161 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/bpiddubnyi/lottery"
 	"github.com/bpiddubnyi/lottery/cmd/lotteryc/game"
+	"github.com/bpiddubnyi/lottery/encoding"
+	"github.com/bpiddubnyi/lottery/encoding/auth"
+	"github.com/bpiddubnyi/lottery/encoding/framed"
+	"github.com/bpiddubnyi/lottery/encoding/signed"
+
+	// Supported protocols
+	_ "github.com/bpiddubnyi/lottery/encoding/binary"
+	_ "github.com/bpiddubnyi/lottery/encoding/jsonl"
+	_ "github.com/bpiddubnyi/lottery/encoding/line"
+	_ "github.com/bpiddubnyi/lottery/encoding/plain"
 )
 
 var (
 	addr     = "127.0.0.1:9876"
 	showHelp bool
 	fee      uint64 = 150
+	proto           = defaultProto
+	maxFrame int
+
+	useTLS     bool
+	caFile     string
+	serverName string
+	insecure   bool
+	certFile   string
+	keyFile    string
+
+	authKeys string
+	authID   string
+
+	verifyKey string
+)
+
+const (
+	defaultProto = "plain"
 )
 
 func init() {
 	flag.StringVar(&addr, "a", addr, "server address")
 	flag.BoolVar(&showHelp, "h", false, "show this help and exit")
 	flag.Uint64Var(&fee, "f", fee, "fee value")
+	flag.StringVar(&proto, "p", proto,
+		fmt.Sprintf("protocol (%s)", strings.Join(encoding.Names(), ", ")))
+	flag.IntVar(&maxFrame, "F", maxFrame,
+		"wrap messages into length-prefixed frames of given max size, 0 disables framing")
+	flag.BoolVar(&useTLS, "tls", useTLS, "connect using TLS")
+	flag.StringVar(&caFile, "ca", caFile, "CA bundle file to verify server certificate, implies -tls")
+	flag.StringVar(&serverName, "servername", serverName,
+		"server name to verify server certificate against, implies -tls")
+	flag.BoolVar(&insecure, "insecure", insecure, "skip server certificate verification, implies -tls")
+	flag.StringVar(&certFile, "cert", certFile, "client TLS certificate file, implies -tls")
+	flag.StringVar(&keyFile, "key", keyFile, "client TLS private key file")
+	flag.StringVar(&authKeys, "auth-keys", authKeys, "key file holding player secret, enables request signing")
+	flag.StringVar(&authID, "auth-id", authID, "player key id in the key file")
+	flag.StringVar(&verifyKey, "verify-key", verifyKey,
+		"server Ed25519 public key PEM file, unsigned responses are refused")
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags]\n", os.Args[0])
+	fmt.Fprintf(out, "       %s verify [verify flags]\n", os.Args[0])
+	flag.PrintDefaults()
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 	if showHelp {
 		flag.Usage()
 		return
 	}
 
+	if flag.Arg(0) == "verify" {
+		if err := verify(flag.Args()[1:]); err != nil {
+			log.Fatalf("fatal: verification failed: %s", err)
+		}
+		return
+	}
+
+	codec, err := encoding.Lookup(proto)
+	if err != nil {
+		fmt.Printf("failed to initialize protocol: %s\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	tlsConf, err := getTLSConfig()
+	if err != nil {
+		fmt.Printf("failed to initialize TLS: %s\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	c := game.NewClient(addr)
+	c.TLSConfig = tlsConf
+	c.Proto = codec.Client
+	if authKeys != "" {
+		signer, err := getSigner()
+		if err != nil {
+			fmt.Printf("failed to initialize request signing: %s\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		c.Proto = auth.NewClient(c.Proto, signer)
+	}
+	if verifyKey != "" {
+		key, err := signed.LoadPublicKey(verifyKey)
+		if err != nil {
+			fmt.Printf("failed to load verification key: %s\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		sc := signed.NewClient(c.Proto, key)
+		sc.OnReceipt = func(rc *signed.Receipt) {
+			log.Printf("info: receipt: %s", rc)
+			if rc.Commit != ([lottery.CommitLen]byte{}) {
+				log.Printf("info: fair draw: commit %x client seed %s nonce %d pair %s",
+					rc.Commit, rc.UUID, rc.Nonce, rc.Draw)
+			}
+		}
+		c.Proto = sc
+	}
+	if maxFrame > 0 {
+		c.Proto = framed.NewClient(c.Proto, maxFrame)
+	}
+	if proto != defaultProto {
+		c.ProtoName = proto
+	}
 	resp, err := c.Play(fee)
-	if err != nil {
+	if se, ok := err.(*lottery.ServerError); ok {
+		log.Fatalf("fatal: server rejected play: %s", se)
+	} else if err != nil {
 		log.Fatalf("fatal: play failed: %s", err)
 	}
 	if resp.Type == lottery.Win {
 		log.Printf("You won %d!", resp.Jackpot)
 	}
 }
+
+func getSigner() (*auth.Signer, error) {
+	keys, err := auth.LoadKeyStore(authKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, ok := keys.Key(authID)
+	if !ok {
+		return nil, fmt.Errorf("key id \"%s\" not found", authID)
+	}
+	return auth.NewSigner(authID, secret)
+}
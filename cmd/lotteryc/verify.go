@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/fair"
+	"github.com/google/uuid"
+)
+
+// verify implements the verify command. It recomputes a provably fair draw
+// from the revealed server seed, see package fair
+func verify(args []string) error {
+	var (
+		seedS, commitS, clientSeedS, pairS string
+		nonce                              uint64
+	)
+
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.StringVar(&seedS, "seed", "", "revealed server seed, hex")
+	fs.StringVar(&commitS, "commit", "", "published server seed commitment to check the seed against, hex")
+	fs.StringVar(&clientSeedS, "client-seed", "", "client seed: request UUID or hex")
+	fs.Uint64Var(&nonce, "nonce", 0, "draw nonce")
+	fs.StringVar(&pairS, "pair", "", "drawn pair to check, a:b")
+	fs.Parse(args)
+
+	if seedS == "" {
+		return errors.New("server seed is required")
+	}
+	seed, err := hex.DecodeString(seedS)
+	if err != nil {
+		return fmt.Errorf("invalid server seed: %s", err)
+	}
+	clientSeed, err := parseClientSeed(clientSeedS)
+	if err != nil {
+		return fmt.Errorf("invalid client seed: %s", err)
+	}
+
+	if commitS != "" {
+		commit, err := hex.DecodeString(commitS)
+		if err != nil {
+			return fmt.Errorf("invalid commitment: %s", err)
+		}
+		if !fair.Verify(seed, commit) {
+			return errors.New("server seed doesn't match the commitment")
+		}
+		fmt.Println("commitment: ok")
+	}
+
+	p := fair.Draw(seed, clientSeed, nonce)
+	fmt.Printf("pair: %s\n", p)
+
+	if pairS != "" {
+		want, err := lottery.ParsePair(pairS)
+		if err != nil {
+			return err
+		}
+		if p != want {
+			return fmt.Errorf("pair %s doesn't match recomputed draw %s", want, p)
+		}
+		fmt.Println("draw: ok")
+	}
+	return nil
+}
+
+// parseClientSeed parses request UUID or hex encoded client seed
+func parseClientSeed(s string) ([]byte, error) {
+	if id, err := uuid.Parse(s); err == nil {
+		return id[:], nil
+	}
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/journal"
+	"github.com/bpiddubnyi/lottery/encoding/signed"
+)
+
+// audit implements the audit command. "audit verify" checks the hash chain
+// and checkpoint signatures of play journal files, see package journal
+func audit(args []string) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return errors.New("unknown audit command, want \"verify\"")
+	}
+
+	var (
+		keyFile string
+		partial bool
+	)
+
+	fs := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s audit verify [flags] journal...\n", os.Args[0])
+		fmt.Fprintln(out, "Journal files are checked as a single chain, rotated files go first, oldest to newest")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&keyFile, "key", "", "Ed25519 public key PEM file to verify checkpoint signatures with")
+	fs.BoolVar(&partial, "partial", false, "Allow the chain to start after entry 1, e.g. when older journal files are removed")
+	fs.Parse(args[1:])
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("journal file is required")
+	}
+
+	v := &journal.Verifier{Partial: partial}
+	if keyFile != "" {
+		key, err := signed.LoadPublicKey(keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load key: %s", err)
+		}
+		v.Key = key
+	} else {
+		fmt.Println("warning: no key given, checkpoint signatures aren't verified")
+	}
+
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		// Entry index is counted over all files, so the line is
+		// found from the entries of the previous files
+		first := v.Entries
+		err = v.Verify(f)
+		f.Close()
+
+		var ce *journal.ChainError
+		if errors.As(err, &ce) {
+			return fmt.Errorf("first bad entry index %d (%s, line %d): %s",
+				ce.Index, path, ce.Index-first+1, ce.Reason)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	fmt.Printf("entries: %d (seq %d-%d)\n", v.Entries, v.FirstSeq, v.LastSeq)
+	fmt.Printf("checkpoints: %d\n", v.Checkpoints)
+	if v.FirstSeq > 1 {
+		fmt.Printf("warning: journal starts at entry %d, earlier entries aren't verified\n", v.FirstSeq)
+	}
+	if v.LastSeq > v.CheckpointSeq {
+		fmt.Printf("warning: %d entries after the last checkpoint aren't signed\n", v.LastSeq-v.CheckpointSeq)
+	}
+	fmt.Println("chain: ok")
+	return nil
+}
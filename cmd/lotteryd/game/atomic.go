@@ -0,0 +1,56 @@
+package game
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// AtomicRing is a lock-free ring of pairs. Every Pop claims the next slot
+// and atomically swaps its pair with a fresh one, so concurrent Pop calls
+// never return the same drawn pair. AtomicRing is safe for concurrent use
+// as long as its entropy source is
+type AtomicRing struct {
+	slots []uint32
+	cur   uint64
+	r     io.Reader
+}
+
+// NewAtomicRing creates atomic ring of depth pairs read from the entropy
+// source r, e.g. crypto/rand.Reader
+func NewAtomicRing(r io.Reader, depth int) (*AtomicRing, error) {
+	if depth <= 0 {
+		return nil, errInvalidDepth
+	}
+
+	s := &AtomicRing{slots: make([]uint32, depth), r: r}
+	for i := range s.slots {
+		var p lottery.Pair
+		if err := readEntropy(r, p[:]); err != nil {
+			return nil, err
+		}
+		s.slots[i] = packPair(p)
+	}
+	return s, nil
+}
+
+// Pop returns the next pair. If the entropy source fails, *EntropyError is
+// returned and the slot keeps its pair
+func (s *AtomicRing) Pop() (lottery.Pair, error) {
+	var newP lottery.Pair
+	if err := readEntropy(s.r, newP[:]); err != nil {
+		return lottery.Pair{}, err
+	}
+
+	i := (atomic.AddUint64(&s.cur, 1) - 1) % uint64(len(s.slots))
+	return unpackPair(atomic.SwapUint32(&s.slots[i], packPair(newP))), nil
+}
+
+func packPair(p lottery.Pair) uint32 {
+	return uint32(p[0])<<8 | uint32(p[1])
+}
+
+func unpackPair(v uint32) lottery.Pair {
+	return lottery.Pair{byte(v >> 8), byte(v)}
+}
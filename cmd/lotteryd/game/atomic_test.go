@@ -0,0 +1,97 @@
+package game
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// counterReader returns big endian 16 bit counter values, so every pair
+// read from it is unique until the counter wraps
+type counterReader struct {
+	n uint16
+}
+
+func (r *counterReader) Read(p []byte) (int, error) {
+	if len(p)%2 != 0 {
+		panic("counterReader: odd read size")
+	}
+	for i := 0; i < len(p); i += 2 {
+		binary.BigEndian.PutUint16(p[i:], r.n)
+		r.n++
+	}
+	return len(p), nil
+}
+
+func TestAtomicRing_ConcurrentPop(t *testing.T) {
+	const (
+		workers = 8
+		pops    = 4000
+	)
+
+	s, err := NewAtomicRing(NewSyncReader(&counterReader{}), DefaultDepth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg    sync.WaitGroup
+		seen  = make(map[lottery.Pair]bool)
+		seenL sync.Mutex
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < pops; j++ {
+				p, err := s.Pop()
+				if err != nil {
+					t.Errorf("AtomicRing.Pop() error = %v", err)
+					return
+				}
+
+				seenL.Lock()
+				if seen[p] {
+					t.Errorf("AtomicRing.Pop() returned %v twice", p)
+				}
+				seen[p] = true
+				seenL.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != workers*pops {
+		t.Errorf("AtomicRing.Pop() returned %d unique pairs, want %d", len(seen), workers*pops)
+	}
+}
+
+func TestNewContainers_Depth(t *testing.T) {
+	for _, depth := range []int{0, -1} {
+		if _, err := NewWinStack(&counterReader{}, depth); err == nil {
+			t.Errorf("NewWinStack(%d) succeeded", depth)
+		}
+		if _, err := NewWinRing(&counterReader{}, depth); err == nil {
+			t.Errorf("NewWinRing(%d) succeeded", depth)
+		}
+		if _, err := NewAtomicRing(&counterReader{}, depth); err == nil {
+			t.Errorf("NewAtomicRing(%d) succeeded", depth)
+		}
+	}
+
+	// Pairs are returned in the order they've been read, after depth pops the
+	// refilled ones come
+	r, err := NewWinRing(&counterReader{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []lottery.Pair{{0, 0}, {0, 1}, {0, 2}, {0, 3}, {0, 4}, {0, 5}}
+	for i, p := range popN(t, r, len(want)) {
+		if p != want[i] {
+			t.Errorf("WinRing.Pop() #%d = %v, want %v", i, p, want[i])
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package game
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// waitEmpty retries pops of a refill stack which is behind, so the benchmark
+// includes the time spent waiting for the refill
+type waitEmpty struct {
+	s PairStack
+}
+
+func (s *waitEmpty) Pop() (lottery.Pair, error) {
+	for {
+		p, err := s.s.Pop()
+		if !errors.Is(err, ErrEmpty) {
+			return p, err
+		}
+		runtime.Gosched()
+	}
+}
+
+func BenchmarkPop_Parallel(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	benchmarks := []struct {
+		name string
+		new  func() (PairStack, error)
+	}{
+		{
+			name: "stack",
+			new: func() (PairStack, error) {
+				s, err := NewWinStack(rand.Reader, DefaultDepth)
+				return NewLocked(s), err
+			},
+		},
+		{
+			name: "ring",
+			new: func() (PairStack, error) {
+				s, err := NewWinRing(rand.Reader, DefaultDepth)
+				return NewLocked(s), err
+			},
+		},
+		{
+			name: "atomic",
+			new:  func() (PairStack, error) { return NewAtomicRing(rand.Reader, DefaultDepth) },
+		},
+		{
+			name: "jit",
+			new:  func() (PairStack, error) { return NewJITStack(rand.Reader), nil },
+		},
+		{
+			name: "refill",
+			new: func() (PairStack, error) {
+				s, err := NewRefillStack(ctx, rand.Reader, DefaultDepth/2, DefaultDepth)
+				return &waitEmpty{s: s}, err
+			},
+		},
+		{
+			name: "seeded",
+			new: func() (PairStack, error) {
+				s, err := NewSeededStack([]byte("seed"))
+				return NewLocked(s), err
+			},
+		},
+	}
+	for _, bb := range benchmarks {
+		b.Run(bb.name, func(b *testing.B) {
+			s, err := bb.new()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := s.Pop(); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// runWorkers runs b.N calls of fn split between workers goroutines
+func runWorkers(b *testing.B, workers int, fn func() error) {
+	var (
+		wg sync.WaitGroup
+		n  = int64(b.N)
+	)
+
+	b.ResetTimer()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for atomic.AddInt64(&n, -1) >= 0 {
+				if err := fn(); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkGame_Play(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		play func() (func() error, error)
+	}{
+		{
+			// The whole play under a global mutex, like the server used to do
+			name: "mutex",
+			play: func() (func() error, error) {
+				s, err := NewWinRing(rand.Reader, DefaultDepth)
+				if err != nil {
+					return nil, err
+				}
+
+				var gL sync.Mutex
+				g := New(s)
+				return func() error {
+					gL.Lock()
+					defer gL.Unlock()
+
+					_, err := g.Play(1, lottery.Pair{1, 2})
+					return err
+				}, nil
+			},
+		},
+		{
+			name: "locked-ring",
+			play: func() (func() error, error) {
+				s, err := NewWinRing(rand.Reader, DefaultDepth)
+				if err != nil {
+					return nil, err
+				}
+
+				g := New(NewLocked(s))
+				return func() error {
+					_, err := g.Play(1, lottery.Pair{1, 2})
+					return err
+				}, nil
+			},
+		},
+		{
+			name: "atomic",
+			play: func() (func() error, error) {
+				s, err := NewAtomicRing(rand.Reader, DefaultDepth)
+				if err != nil {
+					return nil, err
+				}
+
+				g := New(s)
+				return func() error {
+					_, err := g.Play(1, lottery.Pair{1, 2})
+					return err
+				}, nil
+			},
+		},
+	}
+	for _, bb := range benchmarks {
+		for _, workers := range []int{1, 8, 64} {
+			b.Run(fmt.Sprintf("%s/workers-%d", bb.name, workers), func(b *testing.B) {
+				play, err := bb.play()
+				if err != nil {
+					b.Fatal(err)
+				}
+				runWorkers(b, workers, play)
+			})
+		}
+	}
+}
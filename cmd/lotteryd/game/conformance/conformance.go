@@ -0,0 +1,227 @@
+// Package conformance implements statistical fairness tests for lucky pair
+// stacks. Run pops pairs from a game.PairStack and checks both bytes of
+// lottery.Pair for:
+//
+//   - distribution: every byte value shows up, and values are uniform
+//     according to chi-squared test
+//   - serial correlation: consecutive values don't depend on each other,
+//     and neither do the bytes of a pair
+//   - runs: values above and below the median alternate like random ones
+//
+// Tests fail when the statistic is beyond Z standard deviations, so healthy
+// stacks fail once in millions of runs.
+package conformance
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/game"
+)
+
+const (
+	// DefaultPops is the default number of pops per run
+	DefaultPops = 1 << 22
+	// Z is the test threshold in standard deviations
+	Z = 5
+)
+
+// Result is an outcome of a single test
+type Result struct {
+	Name      string
+	Statistic float64
+	Cutoff    float64
+	Pass      bool
+	Detail    string
+}
+
+func (r Result) String() string {
+	status := "ok"
+	if !r.Pass {
+		status = "FAIL"
+	}
+	s := fmt.Sprintf("%s: %s: statistic %.2f, cutoff %.2f", r.Name, status, r.Statistic, r.Cutoff)
+	if r.Detail != "" {
+		s += ": " + r.Detail
+	}
+	return s
+}
+
+// Report is an outcome of a conformance run
+type Report struct {
+	Pops    int
+	Results []Result
+}
+
+// Passed reports whether all tests have passed
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if !res.Pass {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) String() string {
+	lines := make([]string, 0, len(r.Results)+1)
+	lines = append(lines, fmt.Sprintf("%d pops", r.Pops))
+	for _, res := range r.Results {
+		lines = append(lines, res.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// byteStats accumulates statistics of a sequence of bytes
+type byteStats struct {
+	counts [256]int
+
+	n      uint64
+	sum    uint64
+	sumSq  uint64
+	sumLag uint64
+	first  byte
+	last   byte
+	high   uint64
+	runs   uint64
+}
+
+func (s *byteStats) add(b byte) {
+	high := b >= 128
+	if s.n > 0 {
+		s.sumLag += uint64(s.last) * uint64(b)
+		if high != (s.last >= 128) {
+			s.runs++
+		}
+	} else {
+		s.first, s.runs = b, 1
+	}
+
+	s.counts[b]++
+	s.n++
+	s.sum += uint64(b)
+	s.sumSq += uint64(b) * uint64(b)
+	if high {
+		s.high++
+	}
+	s.last = b
+}
+
+func (s *byteStats) distribution(name string) Result {
+	n := float64(s.n)
+	expected := n / 256
+
+	var (
+		x       float64
+		missing int
+		lo, hi  = s.counts[0], s.counts[0]
+	)
+	for _, c := range s.counts {
+		d := float64(c) - expected
+		x += d * d / expected
+		if c == 0 {
+			missing++
+		}
+		if c < lo {
+			lo = c
+		}
+		if c > hi {
+			hi = c
+		}
+	}
+
+	cutoff := game.ChiSquaredCutoff(255, Z)
+	return Result{
+		Name:      name + " distribution",
+		Statistic: x,
+		Cutoff:    cutoff,
+		Pass:      x <= cutoff && missing == 0,
+		Detail:    fmt.Sprintf("%d values missing, counts %d-%d, expected %.0f", missing, lo, hi, expected),
+	}
+}
+
+// serial returns lag-1 serial correlation test, see Knuth TAOCP 3.3.2
+func (s *byteStats) serial(name string) Result {
+	// Sums of x[i] and x[i+1] over n-1 pairs
+	first, last := uint64(s.first), uint64(s.last)
+	n := float64(s.n - 1)
+	sumX := float64(s.sum - last)
+	sumY := float64(s.sum - first)
+	sumXX := float64(s.sumSq - last*last)
+	sumYY := float64(s.sumSq - first*first)
+
+	r := correlation(n, sumX, sumY, sumXX, sumYY, float64(s.sumLag))
+	return zResult(name+" serial correlation", r*math.Sqrt(n),
+		fmt.Sprintf("coefficient %.5f", r))
+}
+
+// runsTest returns Wald-Wolfowitz runs test of values above and below median
+func (s *byteStats) runsTest(name string) Result {
+	n := float64(s.n)
+	n1 := float64(s.high)
+	n2 := n - n1
+
+	mu := 2*n1*n2/n + 1
+	sigma := math.Sqrt((mu - 1) * (mu - 2) / (n - 1))
+	return zResult(name+" runs", (float64(s.runs)-mu)/sigma,
+		fmt.Sprintf("%d runs, expected %.0f", s.runs, mu))
+}
+
+func zResult(name string, z float64, detail string) Result {
+	return Result{
+		Name:      name,
+		Statistic: z,
+		Cutoff:    Z,
+		Pass:      math.Abs(z) <= Z,
+		Detail:    detail,
+	}
+}
+
+// correlation returns Pearson correlation coefficient from sums of n samples
+func correlation(n, sumX, sumY, sumXX, sumYY, sumXY float64) float64 {
+	d := math.Sqrt((n*sumXX - sumX*sumX) * (n*sumYY - sumY*sumY))
+	if d == 0 {
+		return 1
+	}
+	return (n*sumXY - sumX*sumY) / d
+}
+
+// Run pops n pairs from s and tests them
+func Run(s game.PairStack, n int) (*Report, error) {
+	if n < 2 {
+		return nil, fmt.Errorf("at least 2 pops are required, got %d", n)
+	}
+
+	var (
+		stats  [2]byteStats
+		sumAB  uint64
+		report = &Report{Pops: n}
+	)
+	for i := 0; i < n; i++ {
+		p, err := s.Pop()
+		if err != nil {
+			return nil, fmt.Errorf("pop #%d failed: %s", i, err)
+		}
+		for j := range stats {
+			stats[j].add(p[j])
+		}
+		sumAB += uint64(p[0]) * uint64(p[1])
+	}
+
+	names := [2]string{"first byte", "second byte"}
+	for i := range stats {
+		report.Results = append(report.Results,
+			stats[i].distribution(names[i]),
+			stats[i].serial(names[i]),
+			stats[i].runsTest(names[i]))
+	}
+
+	a, b := &stats[0], &stats[1]
+	r := correlation(float64(n), float64(a.sum), float64(b.sum),
+		float64(a.sumSq), float64(b.sumSq), float64(sumAB))
+	report.Results = append(report.Results, zResult("pair correlation",
+		r*math.Sqrt(float64(n)), fmt.Sprintf("coefficient %.5f", r)))
+
+	return report, nil
+}
@@ -0,0 +1,203 @@
+package conformance
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/game"
+)
+
+func pops() int {
+	if testing.Short() {
+		return 1 << 18
+	}
+	return 1 << 21
+}
+
+func TestRun_Containers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		name string
+		new  func() (game.PairStack, error)
+	}{
+		{
+			name: "stack",
+			new:  func() (game.PairStack, error) { return game.NewWinStack(rand.Reader, game.DefaultDepth) },
+		},
+		{
+			name: "ring",
+			new:  func() (game.PairStack, error) { return game.NewWinRing(rand.Reader, game.DefaultDepth) },
+		},
+		{
+			name: "atomic",
+			new:  func() (game.PairStack, error) { return game.NewAtomicRing(rand.Reader, game.DefaultDepth) },
+		},
+		{
+			name: "jit",
+			new:  func() (game.PairStack, error) { return game.NewJITStack(rand.Reader), nil },
+		},
+		{
+			name: "refill",
+			new: func() (game.PairStack, error) {
+				return game.NewRefillStack(ctx, rand.Reader, game.DefaultDepth/2, game.DefaultDepth)
+			},
+		},
+		{
+			name: "fair",
+			new:  func() (game.PairStack, error) { return game.NewFairStack(game.DefaultRotate) },
+		},
+		{
+			name: "seeded",
+			new:  func() (game.PairStack, error) { return game.NewSeededStack([]byte("seed")) },
+		},
+		{
+			name: "health",
+			new: func() (game.PairStack, error) {
+				s, err := game.NewWinRing(game.NewHealthReader(rand.Reader, game.DefaultMinEntropy), game.DefaultDepth)
+				if err != nil {
+					return nil, err
+				}
+				return game.NewMonitor(s, game.DefaultMonitorWindow), nil
+			},
+		},
+	}
+
+	// Fair stack logs every draw
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.new()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := Run(s, pops())
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if !r.Passed() {
+				t.Errorf("Run() failed:\n%s", r)
+			}
+		})
+	}
+}
+
+// stackMock pops pairs generated by next from i-th pop
+type stackMock struct {
+	i    int
+	next func(i int) lottery.Pair
+}
+
+func (s *stackMock) Pop() (lottery.Pair, error) {
+	s.i++
+	return s.next(s.i), nil
+}
+
+func TestRun_Biased(t *testing.T) {
+	seeded, err := game.NewSeededStack([]byte("seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := func() lottery.Pair {
+		p, _ := seeded.Pop()
+		return p
+	}
+
+	// Cycles through 100 pairs like WinStack did when it pushed the popped
+	// pair back instead of a new one
+	cycle := make([]lottery.Pair, 100)
+	for i := range cycle {
+		cycle[i] = random()
+	}
+
+	tests := []struct {
+		name     string
+		next     func(i int) lottery.Pair
+		wantFail []string
+	}{
+		{
+			name:     "cycle",
+			next:     func(i int) lottery.Pair { return cycle[i%len(cycle)] },
+			wantFail: []string{"first byte distribution", "second byte distribution"},
+		},
+		{
+			name: "non-uniform",
+			next: func(i int) lottery.Pair {
+				p := random()
+				p[1] &^= 1
+				return p
+			},
+			wantFail: []string{"second byte distribution"},
+		},
+		{
+			name: "equal bytes",
+			next: func(i int) lottery.Pair {
+				p := random()
+				p[1] = p[0]
+				return p
+			},
+			wantFail: []string{"pair correlation"},
+		},
+		{
+			name: "sticky",
+			next: func(i int) lottery.Pair {
+				// Every other pair repeats the previous one
+				if i%2 == 0 {
+					return cycle[0]
+				}
+				p := random()
+				cycle[0] = p
+				return p
+			},
+			wantFail: []string{"first byte serial correlation", "first byte runs"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Run(&stackMock{next: tt.next}, pops())
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			failed := make(map[string]bool)
+			for _, res := range r.Results {
+				if !res.Pass {
+					failed[res.Name] = true
+				}
+			}
+			for _, name := range tt.wantFail {
+				if !failed[name] {
+					t.Errorf("Run() %s passed:\n%s", name, r)
+				}
+			}
+			if r.Passed() {
+				t.Errorf("Run() passed")
+			}
+		})
+	}
+}
+
+func TestReport_String(t *testing.T) {
+	r := &Report{Pops: 10, Results: []Result{
+		{Name: "a", Statistic: 1, Cutoff: 2, Pass: true},
+		{Name: "b", Statistic: 3, Cutoff: 2, Detail: "details"},
+	}}
+	want := strings.Join([]string{
+		"10 pops",
+		"a: ok: statistic 1.00, cutoff 2.00",
+		"b: FAIL: statistic 3.00, cutoff 2.00: details",
+	}, "\n")
+	if got := r.String(); got != want {
+		t.Errorf("Report.String() = %q, want %q", got, want)
+	}
+}
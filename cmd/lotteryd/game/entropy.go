@@ -0,0 +1,48 @@
+package game
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// EntropyError is returned when lucky pairs can't be generated because
+// the entropy source has failed
+type EntropyError struct {
+	Err error
+}
+
+func (e *EntropyError) Error() string {
+	return fmt.Sprintf("entropy source failed: %s", e.Err)
+}
+
+func (e *EntropyError) Unwrap() error {
+	return e.Err
+}
+
+// readEntropy fills buf from r. Sources like pipes may return less data than
+// requested, so it reads until buf is full
+func readEntropy(r io.Reader, buf []byte) error {
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return &EntropyError{Err: err}
+	}
+	return nil
+}
+
+// SyncReader serializes reads of an entropy source which isn't safe for
+// concurrent use, like a file
+type SyncReader struct {
+	r  io.Reader
+	rL sync.Mutex
+}
+
+func NewSyncReader(r io.Reader) *SyncReader {
+	return &SyncReader{r: r}
+}
+
+func (r *SyncReader) Read(p []byte) (int, error) {
+	r.rL.Lock()
+	defer r.rL.Unlock()
+
+	return r.r.Read(p)
+}
@@ -0,0 +1,96 @@
+package game
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// testReader reads data from r, unless failure is injected with fail
+type testReader struct {
+	r    io.Reader
+	err  error
+	errL sync.Mutex
+}
+
+func (r *testReader) Read(p []byte) (int, error) {
+	r.errL.Lock()
+	err := r.err
+	r.errL.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// fail makes reads fail with err, or succeed again if err is nil
+func (r *testReader) fail(err error) {
+	r.errL.Lock()
+	r.err = err
+	r.errL.Unlock()
+}
+
+func TestEntropyFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func(io.Reader) (PairStack, error)
+	}{
+		{
+			name: "stack",
+			new:  func(r io.Reader) (PairStack, error) { return NewWinStack(r, DefaultDepth) },
+		},
+		{
+			name: "ring",
+			new:  func(r io.Reader) (PairStack, error) { return NewWinRing(r, DefaultDepth) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, DefaultDepth*2+4)
+			for i := range data {
+				data[i] = byte(i)
+			}
+			r := &testReader{r: bytes.NewReader(data)}
+
+			s, err := tt.new(r)
+			if err != nil {
+				t.Fatalf("constructor error = %v", err)
+			}
+
+			if p, err := s.Pop(); err != nil || p != (lottery.Pair{0, 1}) {
+				t.Fatalf("Pop() = %v, %v, want 0:1", p, err)
+			}
+
+			r.fail(errors.New("source is gone"))
+			_, err = s.Pop()
+			var ee *EntropyError
+			if !errors.As(err, &ee) {
+				t.Fatalf("Pop() error = %v, want *EntropyError", err)
+			}
+
+			// Failed Pop doesn't consume the pair
+			r.fail(nil)
+			if p, err := s.Pop(); err != nil || p != (lottery.Pair{2, 3}) {
+				t.Errorf("Pop() after failure = %v, %v, want 2:3", p, err)
+			}
+		})
+	}
+}
+
+func TestShortReads(t *testing.T) {
+	// Pipes may return less data than requested
+	data := bytes.Repeat([]byte{7}, DefaultDepth*2+2)
+	s, err := NewWinRing(iotest.OneByteReader(bytes.NewReader(data)), DefaultDepth)
+	if err != nil {
+		t.Fatalf("NewWinRing() error = %v", err)
+	}
+	if p, err := s.Pop(); err != nil || p != (lottery.Pair{7, 7}) {
+		t.Errorf("Pop() = %v, %v, want 7:7", p, err)
+	}
+}
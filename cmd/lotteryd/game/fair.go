@@ -0,0 +1,101 @@
+package game
+
+import (
+	"errors"
+	"log"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/fair"
+)
+
+const (
+	// DefaultRotate is the default number of draws made with a single
+	// server seed
+	DefaultRotate = 1000
+)
+
+// FairStack is a provably fair lucky pair stack, see package fair. Seed
+// commitments, draws and revealed seeds are logged, so they can be published
+// and checked by players
+type FairStack struct {
+	// Number of draws after which the server seed is revealed and replaced
+	Rotate uint64
+
+	seed   []byte
+	commit []byte
+	nonce  uint64
+}
+
+// NewFairStack creates fair stack and commits the first server seed
+func NewFairStack(rotate uint64) (*FairStack, error) {
+	if rotate == 0 {
+		return nil, errors.New("rotate must be positive")
+	}
+
+	s := &FairStack{Rotate: rotate}
+	if err := s.next(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// next replaces server seed with a new one and commits it
+func (s *FairStack) next() error {
+	seed, err := fair.NewSeed()
+	if err != nil {
+		return err
+	}
+
+	s.seed, s.commit, s.nonce = seed, fair.Commit(seed), 0
+	log.Printf("info: fair: seed committed: commit %x", s.commit)
+	return nil
+}
+
+// reveal logs the current server seed, it can't be used for draws afterwards
+func (s *FairStack) reveal() {
+	log.Printf("info: fair: seed revealed: commit %x seed %x draws %d", s.commit, s.seed, s.nonce)
+}
+
+// Commit returns commitment of the current server seed
+func (s *FairStack) Commit() []byte {
+	return s.commit
+}
+
+// Pop draws a pair with empty client seed
+func (s *FairStack) Pop() (lottery.Pair, error) {
+	d, err := s.PopSeeded(nil)
+	return d.Pair, err
+}
+
+// PopSeeded draws a pair for the client seed. The draw carries the server
+// seed commitment and nonce. Server seed is rotated once it's been used
+// Rotate times
+func (s *FairStack) PopSeeded(clientSeed []byte) (Draw, error) {
+	if s.seed == nil {
+		return Draw{}, errors.New("fair stack is closed")
+	}
+
+	d := Draw{Pair: fair.Draw(s.seed, clientSeed, s.nonce), Commit: s.commit, Nonce: s.nonce}
+	log.Printf("info: fair: draw: commit %x client seed %x nonce %d pair %s", s.commit, clientSeed, s.nonce, d.Pair)
+	s.nonce++
+
+	if s.nonce >= s.Rotate {
+		s.reveal()
+		if err := s.next(); err != nil {
+			s.seed = nil
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+// Close reveals the current server seed. No draws can be made afterwards
+func (s *FairStack) Close() error {
+	if s.seed == nil {
+		return nil
+	}
+
+	s.reveal()
+	s.seed = nil
+	return nil
+}
@@ -0,0 +1,48 @@
+package game
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery/fair"
+)
+
+func TestFairStack_PopSeeded(t *testing.T) {
+	s, err := NewFairStack(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientSeed := []byte("client seed")
+	for round := 0; round < 2; round++ {
+		seed, commit := s.seed, s.Commit()
+		if !fair.Verify(seed, commit) {
+			t.Fatalf("round %d: seed doesn't match commitment", round)
+		}
+
+		for nonce := uint64(0); nonce < 3; nonce++ {
+			got, err := s.PopSeeded(clientSeed)
+			if err != nil {
+				t.Fatalf("FairStack.PopSeeded() error = %v", err)
+			}
+			if want := fair.Draw(seed, clientSeed, nonce); got.Pair != want {
+				t.Errorf("round %d: FairStack.PopSeeded() = %v, want %v", round, got.Pair, want)
+			}
+			if !bytes.Equal(got.Commit, commit) || got.Nonce != nonce {
+				t.Errorf("round %d: FairStack.PopSeeded() commit %x nonce %d, want %x %d",
+					round, got.Commit, got.Nonce, commit, nonce)
+			}
+		}
+
+		if bytes.Equal(s.Commit(), commit) {
+			t.Errorf("round %d: seed isn't rotated", round)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("FairStack.Close() error = %v", err)
+	}
+	if _, err := s.Pop(); err == nil {
+		t.Errorf("FairStack.Pop() after close succeeded")
+	}
+}
@@ -1,16 +1,71 @@
 package game
 
-import "github.com/bpiddubnyi/lottery"
+import (
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/bpiddubnyi/lottery"
+)
 
 // PairStack is a comon interface for different lucky pair stack implementations
 type PairStack interface {
 	Pop() (lottery.Pair, error)
 }
 
-// Game describes lottery game logic
+// SeededPairStack is implemented by stacks which derive lucky pairs from
+// a seed chosen by the player, like FairStack
+type SeededPairStack interface {
+	PairStack
+	PopSeeded(clientSeed []byte) (Draw, error)
+}
+
+// Draw is a lucky pair popped from a stack. Provably fair draws also carry
+// the server seed commitment and the nonce, so players can check them once
+// the seed is revealed
+type Draw struct {
+	Pair   lottery.Pair
+	Commit []byte
+	Nonce  uint64
+}
+
+// pop pops a pair from s, passing client seed to SeededPairStack
+func pop(s PairStack, clientSeed []byte) (Draw, error) {
+	if ss, ok := s.(SeededPairStack); ok {
+		return ss.PopSeeded(clientSeed)
+	}
+	p, err := s.Pop()
+	return Draw{Pair: p}, err
+}
+
+// Limits restricts fees accepted by the game and the jackpot size. Zero
+// maximums mean no limit
+type Limits struct {
+	MinFee     uint64
+	MaxFee     uint64
+	MaxJackpot uint64
+}
+
+// RejectError is returned when a play breaks game limits or would overflow
+// the jackpot. Rejected plays don't change the jackpot
+type RejectError struct {
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	return "play rejected: " + e.Reason
+}
+
+// Game describes lottery game logic. Game is safe for concurrent use: plays
+// draw pairs concurrently and update the jackpot atomically, so every play
+// takes effect at a single point in time. Stack must be safe for concurrent
+// use, wrap it with Locked otherwise
 type Game struct {
+	// Jackpot is accessed atomically, it must stay the first field to be
+	// 64-bit aligned on 32-bit platforms
 	Jackpot uint64
 	Stack   PairStack
+	Limits  Limits
 }
 
 // New creates new Game instance
@@ -18,26 +73,123 @@ func New(stack PairStack) *Game {
 	return &Game{Stack: stack}
 }
 
+// LoadJackpot returns the current jackpot
+func (g *Game) LoadJackpot() uint64 {
+	return atomic.LoadUint64(&g.Jackpot)
+}
+
 // Play checks if player's bet metches to a win pair from lucky pairs stack and
 // returns a match result
 func (g *Game) Play(fee uint64, bet lottery.Pair) (*lottery.Response, error) {
-	win, err := g.Stack.Pop()
+	return g.PlaySeeded(fee, bet, nil)
+}
+
+// PlaySeeded is like Play, but passes player's seed to stacks implementing
+// SeededPairStack. Plays breaking game limits fail with *RejectError
+func (g *Game) PlaySeeded(fee uint64, bet lottery.Pair, clientSeed []byte) (*lottery.Response, error) {
+	o, err := g.PlayOutcome(fee, bet, clientSeed)
 	if err != nil {
 		return nil, err
 	}
+	return o.Response, nil
+}
+
+// Outcome is a result of a play along with the jackpot change it made
+type Outcome struct {
+	Response *lottery.Response
+	// Jackpot right before and after the play took effect
+	JackpotBefore uint64
+	JackpotAfter  uint64
+}
+
+// PlayOutcome is like PlaySeeded, but also reports the jackpot change
+func (g *Game) PlayOutcome(fee uint64, bet lottery.Pair, clientSeed []byte) (*Outcome, error) {
+	return g.playOutcome(fee, bet, clientSeed, false)
+}
 
-	r := &lottery.Response{Type: lottery.NoWin}
-	if win == bet {
-		if g.Jackpot != 0 {
-			r.Type = lottery.Win
-			r.Jackpot = g.Jackpot + fee
-			g.Jackpot = 0
-		} else {
-			r.Type = lottery.Bonus
-			g.Jackpot = fee
+// PlayBonus is like PlayOutcome, but plays the free round granted by a Bonus
+// response, so the fee isn't checked against MinFee
+func (g *Game) PlayBonus(fee uint64, bet lottery.Pair, clientSeed []byte) (*Outcome, error) {
+	return g.playOutcome(fee, bet, clientSeed, true)
+}
+
+func (g *Game) playOutcome(fee uint64, bet lottery.Pair, clientSeed []byte, bonus bool) (*Outcome, error) {
+	if err := g.checkFee(fee, bonus); err != nil {
+		return nil, err
+	}
+	// Don't waste a draw if neither a prize nor the jackpot can hold the
+	// fee. The jackpot cap only applies to losing plays, so the jackpot
+	// can still be won once it's reached
+	if _, carry := bits.Add64(g.LoadJackpot(), fee, 0); carry != 0 {
+		return nil, &RejectError{Reason: "jackpot overflows"}
+	}
+
+	d, err := pop(g.Stack, clientSeed)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Outcome{Response: &lottery.Response{Type: lottery.NoWin, Draw: d.Pair, Nonce: d.Nonce}}
+	copy(o.Response.Commit[:], d.Commit)
+	if d.Pair != bet {
+		for {
+			jackpot := atomic.LoadUint64(&g.Jackpot)
+			sum, err := g.addFee(jackpot, fee)
+			if err != nil {
+				return nil, err
+			}
+			if atomic.CompareAndSwapUint64(&g.Jackpot, jackpot, sum) {
+				o.JackpotBefore, o.JackpotAfter = jackpot, sum
+				return o, nil
+			}
+		}
+	}
+
+	// Winner takes the jackpot, unless it's empty, which gives a bonus game
+	// and starts a new one
+	for {
+		jackpot := atomic.LoadUint64(&g.Jackpot)
+		if jackpot != 0 {
+			prize, carry := bits.Add64(jackpot, fee, 0)
+			if carry != 0 {
+				return nil, &RejectError{Reason: "prize overflows"}
+			}
+			if atomic.CompareAndSwapUint64(&g.Jackpot, jackpot, 0) {
+				o.Response.Type = lottery.Win
+				o.Response.Jackpot = prize
+				o.JackpotBefore = jackpot
+				return o, nil
+			}
+		} else if atomic.CompareAndSwapUint64(&g.Jackpot, 0, fee) {
+			o.Response.Type = lottery.Bonus
+			o.JackpotAfter = fee
+			return o, nil
 		}
-	} else {
-		g.Jackpot += fee
 	}
-	return r, nil
+}
+
+func (g *Game) checkFee(fee uint64, bonus bool) error {
+	if !bonus && fee < g.Limits.MinFee {
+		return &RejectError{Reason: fmt.Sprintf("fee %d is below minimum of %d", fee, g.Limits.MinFee)}
+	}
+	if g.Limits.MaxFee != 0 && fee > g.Limits.MaxFee {
+		return &RejectError{Reason: fmt.Sprintf("fee %d exceeds maximum of %d", fee, g.Limits.MaxFee)}
+	}
+	if g.Limits.MaxJackpot != 0 && fee > g.Limits.MaxJackpot {
+		return &RejectError{Reason: fmt.Sprintf("fee %d exceeds jackpot maximum of %d", fee, g.Limits.MaxJackpot)}
+	}
+	return nil
+}
+
+// addFee returns jackpot increased by a fee of a losing play, or
+// *RejectError if the sum overflows or exceeds the jackpot limit
+func (g *Game) addFee(jackpot, fee uint64) (uint64, error) {
+	sum, carry := bits.Add64(jackpot, fee, 0)
+	if carry != 0 {
+		return 0, &RejectError{Reason: "jackpot overflows"}
+	}
+	if g.Limits.MaxJackpot != 0 && sum > g.Limits.MaxJackpot {
+		return 0, &RejectError{Reason: fmt.Sprintf("jackpot would exceed maximum of %d", g.Limits.MaxJackpot)}
+	}
+	return sum, nil
 }
@@ -1,7 +1,13 @@
 package game
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	mrand "math/rand"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/bpiddubnyi/lottery"
@@ -17,6 +23,7 @@ func TestGame_Play(t *testing.T) {
 	type fields struct {
 		Jackpot uint64
 		Stack   PairStack
+		Limits  Limits
 	}
 	type args struct {
 		fee uint64
@@ -43,6 +50,7 @@ func TestGame_Play(t *testing.T) {
 			want: &lottery.Response{
 				Type:    lottery.Win,
 				Jackpot: 100,
+				Draw:    lottery.Pair{1, 1},
 			},
 			wantErr:          false,
 			wantJackPotAfter: 0,
@@ -60,6 +68,7 @@ func TestGame_Play(t *testing.T) {
 			want: &lottery.Response{
 				Type:    lottery.NoWin,
 				Jackpot: 0,
+				Draw:    lottery.Pair{1, 1},
 			},
 			wantErr:          false,
 			wantJackPotAfter: 100,
@@ -77,22 +86,187 @@ func TestGame_Play(t *testing.T) {
 			want: &lottery.Response{
 				Type:    lottery.Bonus,
 				Jackpot: 0,
+				Draw:    lottery.Pair{1, 1},
 			},
 			wantErr:          false,
 			wantJackPotAfter: 42,
 		},
+		{
+			name: "jackpot overflow",
+			fields: fields{
+				Jackpot: 58,
+				Stack:   stackMockOnes{},
+			},
+			args: args{
+				fee: math.MaxUint64,
+				bet: lottery.Pair{1, 2},
+			},
+			wantErr:          true,
+			wantJackPotAfter: 58,
+		},
+		{
+			name: "max fee",
+			fields: fields{
+				Jackpot: 0,
+				Stack:   stackMockOnes{},
+				Limits:  Limits{MaxFee: math.MaxUint64},
+			},
+			args: args{
+				fee: math.MaxUint64,
+				bet: lottery.Pair{1, 1},
+			},
+			want: &lottery.Response{
+				Type:    lottery.Bonus,
+				Jackpot: 0,
+				Draw:    lottery.Pair{1, 1},
+			},
+			wantErr:          false,
+			wantJackPotAfter: math.MaxUint64,
+		},
+		{
+			name: "fee below min",
+			fields: fields{
+				Jackpot: 58,
+				Stack:   stackMockOnes{},
+				Limits:  Limits{MinFee: 10},
+			},
+			args: args{
+				fee: 9,
+				bet: lottery.Pair{1, 1},
+			},
+			wantErr:          true,
+			wantJackPotAfter: 58,
+		},
+		{
+			name: "fee above max",
+			fields: fields{
+				Jackpot: 58,
+				Stack:   stackMockOnes{},
+				Limits:  Limits{MaxFee: 100},
+			},
+			args: args{
+				fee: 101,
+				bet: lottery.Pair{1, 1},
+			},
+			wantErr:          true,
+			wantJackPotAfter: 58,
+		},
+		{
+			name: "jackpot above max",
+			fields: fields{
+				Jackpot: 58,
+				Stack:   stackMockOnes{},
+				Limits:  Limits{MaxJackpot: 99},
+			},
+			args: args{
+				fee: 42,
+				bet: lottery.Pair{1, 2},
+			},
+			wantErr:          true,
+			wantJackPotAfter: 58,
+		},
+		{
+			name: "jackpot at max",
+			fields: fields{
+				Jackpot: 58,
+				Stack:   stackMockOnes{},
+				Limits:  Limits{MaxJackpot: 100},
+			},
+			args: args{
+				fee: 42,
+				bet: lottery.Pair{1, 2},
+			},
+			want: &lottery.Response{
+				Type:    lottery.NoWin,
+				Jackpot: 0,
+				Draw:    lottery.Pair{1, 1},
+			},
+			wantErr:          false,
+			wantJackPotAfter: 100,
+		},
+		{
+			name: "jackpot at cap, winning guess",
+			fields: fields{
+				Jackpot: 100,
+				Stack:   stackMockOnes{},
+				Limits:  Limits{MaxJackpot: 100},
+			},
+			args: args{
+				fee: 1,
+				bet: lottery.Pair{1, 1},
+			},
+			want: &lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: 101,
+				Draw:    lottery.Pair{1, 1},
+			},
+			wantErr:          false,
+			wantJackPotAfter: 0,
+		},
+		{
+			name: "jackpot at cap, losing guess",
+			fields: fields{
+				Jackpot: 100,
+				Stack:   stackMockOnes{},
+				Limits:  Limits{MaxJackpot: 100},
+			},
+			args: args{
+				fee: 1,
+				bet: lottery.Pair{1, 2},
+			},
+			wantErr:          true,
+			wantJackPotAfter: 100,
+		},
+		{
+			name: "jackpot over cap, winning guess",
+			fields: fields{
+				Jackpot: 150,
+				Stack:   stackMockOnes{},
+				Limits:  Limits{MaxJackpot: 100},
+			},
+			args: args{
+				fee: 1,
+				bet: lottery.Pair{1, 1},
+			},
+			want: &lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: 151,
+				Draw:    lottery.Pair{1, 1},
+			},
+			wantErr:          false,
+			wantJackPotAfter: 0,
+		},
+		{
+			name: "bonus above max jackpot",
+			fields: fields{
+				Jackpot: 0,
+				Stack:   stackMockOnes{},
+				Limits:  Limits{MaxJackpot: 41},
+			},
+			args: args{
+				fee: 42,
+				bet: lottery.Pair{1, 1},
+			},
+			wantErr:          true,
+			wantJackPotAfter: 0,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			g := &Game{
 				Jackpot: tt.fields.Jackpot,
 				Stack:   tt.fields.Stack,
+				Limits:  tt.fields.Limits,
 			}
 			got, err := g.Play(tt.args.fee, tt.args.bet)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Game.Play() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			var re *RejectError
+			if err != nil && !errors.As(err, &re) {
+				t.Errorf("Game.Play() error = %v, want *RejectError", err)
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Game.Play() = %v, want %v", got, tt.want)
 			}
@@ -102,3 +276,97 @@ func TestGame_Play(t *testing.T) {
 		})
 	}
 }
+
+// bitReader returns random bytes of value 0 or 1, so pairs drawn from it
+// match a guess often
+type bitReader struct {
+	rnd *mrand.Rand
+}
+
+func (r *bitReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r.rnd.Intn(2))
+	}
+	return len(p), nil
+}
+
+func TestGame_ConcurrentPlay(t *testing.T) {
+	const (
+		workers = 16
+		plays   = 5000
+	)
+
+	g := New(NewJITStack(NewSyncReader(&bitReader{rnd: mrand.New(mrand.NewSource(1))})))
+
+	var (
+		wg                  sync.WaitGroup
+		fees, paid          uint64
+		wins, bonuses, lost uint64
+		// Sum of jackpot changes reported by outcomes
+		delta int64
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			rnd := mrand.New(mrand.NewSource(seed))
+			for j := 0; j < plays; j++ {
+				fee := uint64(rnd.Intn(100) + 1)
+				bet := lottery.Pair{byte(rnd.Intn(2)), byte(rnd.Intn(2))}
+
+				o, err := g.PlayOutcome(fee, bet, nil)
+				if err != nil {
+					t.Errorf("Game.PlayOutcome() error = %v", err)
+					return
+				}
+				atomic.AddUint64(&fees, fee)
+				atomic.AddInt64(&delta, int64(o.JackpotAfter)-int64(o.JackpotBefore))
+
+				if err := checkOutcome(o, fee); err != nil {
+					t.Error(err)
+				}
+				r := o.Response
+
+				switch r.Type {
+				case lottery.Win:
+					atomic.AddUint64(&wins, 1)
+					atomic.AddUint64(&paid, r.Jackpot)
+				case lottery.Bonus:
+					atomic.AddUint64(&bonuses, 1)
+				default:
+					atomic.AddUint64(&lost, 1)
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	// Every fee is either paid out or still in the jackpot
+	if jackpot := g.LoadJackpot(); fees != paid+jackpot {
+		t.Errorf("fees %d != paid %d + jackpot %d", fees, paid, jackpot)
+	}
+	if jackpot := g.LoadJackpot(); int64(jackpot) != delta {
+		t.Errorf("jackpot %d != sum of outcome changes %d", jackpot, delta)
+	}
+	// Fees are positive, so the jackpot is only empty at start and after
+	// a win. Only the first play after that gets a bonus
+	if bonuses > wins+1 {
+		t.Errorf("%d bonuses for %d wins", bonuses, wins)
+	}
+	if wins == 0 || bonuses == 0 || lost == 0 {
+		t.Errorf("not all outcomes are played: %d wins, %d bonuses, %d lost", wins, bonuses, lost)
+	}
+}
+
+// checkOutcome reports outcome o of a play of fee breaking the game rules
+func checkOutcome(o *Outcome, fee uint64) error {
+	r := o.Response
+	switch {
+	case r.Type == lottery.Win && (o.JackpotAfter != 0 || r.Jackpot != o.JackpotBefore+fee),
+		r.Type == lottery.Bonus && (o.JackpotBefore != 0 || o.JackpotAfter != fee),
+		r.Type == lottery.NoWin && o.JackpotAfter != o.JackpotBefore+fee:
+		return fmt.Errorf("%s of fee %d: jackpot %d -> %d", r, fee, o.JackpotBefore, o.JackpotAfter)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package game
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+const (
+	// DefaultMinEntropy is min-entropy per byte claimed for entropy sources,
+	// in bits. OS randomness is expected to provide full entropy
+	DefaultMinEntropy = 8
+	// DefaultMonitorWindow is the default number of pops between
+	// distribution checks
+	DefaultMonitorWindow = 1 << 16
+
+	// Health tests false positive probability is 2^-healthAlphaLog2. SP 800-90B
+	// recommends 2^-20 to 2^-40, the lower end keeps lotteryd from stopping on
+	// a healthy source
+	healthAlphaLog2 = 40
+	// Adaptive proportion test window for non-binary sources
+	aptWindow = 512
+
+	// Chi-squared test threshold in standard deviations, false positive
+	// probability is around 1e-9
+	chiSquaredZ = 6
+)
+
+// HealthError is returned once an RNG health test has failed. Failures are
+// permanent, the source must not be used afterwards
+type HealthError struct {
+	Test   string
+	Reason string
+}
+
+func (e *HealthError) Error() string {
+	return fmt.Sprintf("RNG health test failed: %s: %s", e.Test, e.Reason)
+}
+
+// HealthReader runs continuous health tests on bytes read from an entropy
+// source: repetition count test and adaptive proportion test, as described in
+// NIST SP 800-90B section 4.4. HealthReader is safe for concurrent use, reads
+// of the underlying source are serialized
+type HealthReader struct {
+	r   io.Reader
+	rL  sync.Mutex
+	err error
+
+	rctCutoff int
+	last      byte
+	repeats   int
+
+	aptCutoff int
+	aptFirst  byte
+	aptCount  int
+	aptSeen   int
+}
+
+// NewHealthReader creates health testing reader of r. minEntropy is the
+// assessed min-entropy per byte of r, in bits
+func NewHealthReader(r io.Reader, minEntropy float64) *HealthReader {
+	return &HealthReader{
+		r:         r,
+		rctCutoff: rctCutoff(minEntropy, healthAlphaLog2),
+		aptCutoff: aptCutoff(minEntropy, healthAlphaLog2),
+	}
+}
+
+// Read reads from the underlying source and tests every byte. Once a test
+// fails, Read returns *HealthError
+func (h *HealthReader) Read(p []byte) (int, error) {
+	h.rL.Lock()
+	defer h.rL.Unlock()
+
+	if h.err != nil {
+		return 0, h.err
+	}
+
+	n, err := h.r.Read(p)
+	for _, b := range p[:n] {
+		if h.err = h.test(b); h.err != nil {
+			return 0, h.err
+		}
+	}
+	return n, err
+}
+
+func (h *HealthReader) test(b byte) error {
+	// Repetition count test
+	if h.repeats > 0 && b == h.last {
+		h.repeats++
+		if h.repeats >= h.rctCutoff {
+			return &HealthError{
+				Test:   "repetition count test",
+				Reason: fmt.Sprintf("value %d repeated %d times", b, h.repeats),
+			}
+		}
+	} else {
+		h.last, h.repeats = b, 1
+	}
+
+	// Adaptive proportion test
+	if h.aptSeen == 0 {
+		h.aptFirst, h.aptCount = b, 1
+	} else if b == h.aptFirst {
+		h.aptCount++
+		if h.aptCount >= h.aptCutoff {
+			return &HealthError{
+				Test: "adaptive proportion test",
+				Reason: fmt.Sprintf("value %d seen %d times in %d samples",
+					b, h.aptCount, aptWindow),
+			}
+		}
+	}
+	h.aptSeen++
+	if h.aptSeen == aptWindow {
+		h.aptSeen = 0
+	}
+	return nil
+}
+
+// rctCutoff returns repetition count test cutoff for min-entropy h and false
+// positive probability 2^-alphaLog2
+func rctCutoff(h float64, alphaLog2 int) int {
+	return 1 + int(math.Ceil(float64(alphaLog2)/h))
+}
+
+// aptCutoff returns adaptive proportion test cutoff for min-entropy h and false
+// positive probability 2^-alphaLog2
+func aptCutoff(h float64, alphaLog2 int) int {
+	return 1 + critBinom(aptWindow, math.Pow(2, -h), math.Pow(2, -float64(alphaLog2)))
+}
+
+// critBinom returns the smallest k such that P(X > k) <= alpha for binomial
+// distribution with n trials and success probability p
+func critBinom(n int, p, alpha float64) int {
+	tail := 0.0
+	k := n
+	for ; k > 0; k-- {
+		// P(X > k-1) = P(X > k) + P(X = k)
+		t := tail + binomPMF(n, k, p)
+		if t > alpha {
+			break
+		}
+		tail = t
+	}
+	return k
+}
+
+func binomPMF(n, k int, p float64) float64 {
+	lnN, _ := math.Lgamma(float64(n + 1))
+	lnK, _ := math.Lgamma(float64(k + 1))
+	lnNK, _ := math.Lgamma(float64(n - k + 1))
+	return math.Exp(lnN - lnK - lnNK + float64(k)*math.Log(p) + float64(n-k)*math.Log1p(-p))
+}
+
+// Monitor is a PairStack wrapper checking distribution of drawn pairs. Every
+// Window pops each byte of the pair is checked with chi-squared test for
+// uniformity. Once a check fails, Pop returns *HealthError. Monitor isn't safe
+// for concurrent use
+type Monitor struct {
+	Stack  PairStack
+	Window int
+
+	counts [2][256]int
+	n      int
+	cutoff float64
+	err    error
+}
+
+// NewMonitor creates distribution monitor of stack
+func NewMonitor(stack PairStack, window int) *Monitor {
+	return &Monitor{
+		Stack:  stack,
+		Window: window,
+		cutoff: ChiSquaredCutoff(255, chiSquaredZ),
+	}
+}
+
+func (m *Monitor) Pop() (lottery.Pair, error) {
+	d, err := m.PopSeeded(nil)
+	return d.Pair, err
+}
+
+// PopSeeded passes client seed to stacks implementing SeededPairStack
+func (m *Monitor) PopSeeded(clientSeed []byte) (Draw, error) {
+	if m.err != nil {
+		return Draw{}, m.err
+	}
+
+	d, err := pop(m.Stack, clientSeed)
+	if err != nil {
+		return d, err
+	}
+	p := d.Pair
+
+	m.counts[0][p[0]]++
+	m.counts[1][p[1]]++
+	m.n++
+	if m.n < m.Window {
+		return d, nil
+	}
+
+	for i := range m.counts {
+		if x := chiSquared(m.counts[i][:], m.n); x > m.cutoff {
+			m.err = &HealthError{
+				Test: "chi-squared test",
+				Reason: fmt.Sprintf("byte %d of %d pairs isn't uniform: statistic %.1f exceeds %.1f",
+					i, m.n, x, m.cutoff),
+			}
+			return Draw{}, m.err
+		}
+	}
+	m.counts, m.n = [2][256]int{}, 0
+	return d, nil
+}
+
+// Close closes the wrapped stack if it's an io.Closer
+func (m *Monitor) Close() error {
+	if c, ok := m.Stack.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// chiSquared returns chi-squared statistic of counts of n uniformly
+// distributed samples
+func chiSquared(counts []int, n int) float64 {
+	expected := float64(n) / float64(len(counts))
+
+	var x float64
+	for _, c := range counts {
+		d := float64(c) - expected
+		x += d * d / expected
+	}
+	return x
+}
+
+// ChiSquaredCutoff returns chi-squared critical value for df degrees of
+// freedom z standard deviations away, using Wilson-Hilferty approximation
+func ChiSquaredCutoff(df, z float64) float64 {
+	a := 2 / (9 * df)
+	return df * math.Pow(1-a+z*math.Sqrt(a), 3)
+}
@@ -0,0 +1,162 @@
+package game
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+func TestAptCutoff(t *testing.T) {
+	// SP 800-90B Table 2, W = 512, alpha = 2^-20
+	tests := []struct {
+		h    float64
+		want int
+	}{
+		{h: 0.5, want: 410},
+		{h: 1, want: 311},
+		{h: 2, want: 177},
+		{h: 4, want: 62},
+		{h: 8, want: 13},
+	}
+	for _, tt := range tests {
+		if got := aptCutoff(tt.h, 20); got != tt.want {
+			t.Errorf("aptCutoff(%v) = %d, want %d", tt.h, got, tt.want)
+		}
+	}
+}
+
+func TestRctCutoff(t *testing.T) {
+	tests := []struct {
+		h    float64
+		want int
+	}{
+		{h: 8, want: 4},
+		{h: 1, want: 21},
+		{h: 0.5, want: 41},
+	}
+	for _, tt := range tests {
+		if got := rctCutoff(tt.h, 20); got != tt.want {
+			t.Errorf("rctCutoff(%v) = %d, want %d", tt.h, got, tt.want)
+		}
+	}
+}
+
+// alternating returns data with every other byte equal to zero
+func alternating(n int) []byte {
+	data := make([]byte, n)
+	for i := 1; i < n; i += 2 {
+		data[i] = byte(i%255) + 1
+	}
+	return data
+}
+
+func TestHealthReader_Read(t *testing.T) {
+	random := make([]byte, 1<<20)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantTest string
+	}{
+		{
+			name: "random",
+			data: random,
+		},
+		{
+			name:     "stuck",
+			data:     bytes.Repeat([]byte{42}, 1024),
+			wantTest: "repetition count test",
+		},
+		{
+			name:     "biased",
+			data:     alternating(1024),
+			wantTest: "adaptive proportion test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthReader(bytes.NewReader(tt.data), DefaultMinEntropy)
+
+			_, err := io.Copy(io.Discard, h)
+			var he *HealthError
+			if tt.wantTest == "" {
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &he) || he.Test != tt.wantTest {
+				t.Fatalf("Read() error = %v, want %s failure", err, tt.wantTest)
+			}
+
+			// Failure is permanent
+			if _, err := h.Read(make([]byte, 1)); err != he {
+				t.Errorf("Read() after failure error = %v", err)
+			}
+		})
+	}
+}
+
+// stackMockCycle cycles through n pairs
+type stackMockCycle struct {
+	n, i int
+}
+
+func (s *stackMockCycle) Pop() (lottery.Pair, error) {
+	s.i = (s.i + 1) % s.n
+	return lottery.Pair{byte(s.i), byte(s.i)}, nil
+}
+
+func TestMonitor_Pop(t *testing.T) {
+	seeded, err := NewSeededStack([]byte("seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		stack   PairStack
+		wantErr bool
+	}{
+		{
+			name:  "uniform",
+			stack: seeded,
+		},
+		{
+			name:    "cycle",
+			stack:   &stackMockCycle{n: 100},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMonitor(tt.stack, DefaultMonitorWindow)
+
+			var err error
+			for i := 0; i < 4*DefaultMonitorWindow && err == nil; i++ {
+				_, err = m.Pop()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Monitor.Pop() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+
+			var he *HealthError
+			if !errors.As(err, &he) {
+				t.Fatalf("Monitor.Pop() error = %v, want *HealthError", err)
+			}
+			if _, err := m.Pop(); err != he {
+				t.Errorf("Monitor.Pop() after failure error = %v", err)
+			}
+		})
+	}
+}
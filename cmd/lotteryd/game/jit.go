@@ -0,0 +1,28 @@
+package game
+
+import (
+	"io"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// JITStack draws pairs from the entropy source on demand, with no buffered
+// pairs. JITStack is safe for concurrent use as long as its entropy
+// source is
+type JITStack struct {
+	r io.Reader
+}
+
+func NewJITStack(r io.Reader) *JITStack {
+	return &JITStack{r: r}
+}
+
+// Pop reads a new pair. If the entropy source fails, *EntropyError is
+// returned
+func (s *JITStack) Pop() (lottery.Pair, error) {
+	var p lottery.Pair
+	if err := readEntropy(s.r, p[:]); err != nil {
+		return lottery.Pair{}, err
+	}
+	return p, nil
+}
@@ -0,0 +1,43 @@
+package game
+
+import (
+	"io"
+	"sync"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// Locked serializes pops of a stack which isn't safe for concurrent use,
+// like WinStack or WinRing
+type Locked struct {
+	s  PairStack
+	sL sync.Mutex
+}
+
+func NewLocked(s PairStack) *Locked {
+	return &Locked{s: s}
+}
+
+func (l *Locked) Pop() (lottery.Pair, error) {
+	d, err := l.PopSeeded(nil)
+	return d.Pair, err
+}
+
+// PopSeeded passes client seed to stacks implementing SeededPairStack
+func (l *Locked) PopSeeded(clientSeed []byte) (Draw, error) {
+	l.sL.Lock()
+	defer l.sL.Unlock()
+
+	return pop(l.s, clientSeed)
+}
+
+// Close closes the wrapped stack if it's an io.Closer
+func (l *Locked) Close() error {
+	l.sL.Lock()
+	defer l.sL.Unlock()
+
+	if c, ok := l.s.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
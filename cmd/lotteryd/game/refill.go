@@ -0,0 +1,183 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+const (
+	// DefaultRefillWait is the default time RefillStack.Pop waits for the
+	// buffer to be refilled
+	DefaultRefillWait = time.Second
+
+	// Delay between reads of failed entropy source
+	refillRetryDelay = 100 * time.Millisecond
+)
+
+var (
+	// ErrEmpty is returned by RefillStack.Pop, wrapped in *EntropyError,
+	// when the buffer isn't refilled in time
+	ErrEmpty = errors.New("pair buffer is empty")
+
+	errStopped = errors.New("refill stack is stopped")
+)
+
+// RefillStack is a container refilled from the entropy source by a background
+// goroutine, so Pop doesn't read randomness itself. Once the number of
+// buffered pairs drops below the low watermark, the buffer is refilled up to
+// the high one. RefillStack is safe for concurrent use
+type RefillStack struct {
+	// Max time Pop waits for a pair when the buffer is empty
+	Wait time.Duration
+
+	c      chan lottery.Pair
+	low    int
+	wake   chan struct{}
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	r      io.Reader
+
+	// The last entropy source error, nil once it's recovered
+	err  error
+	errL sync.Mutex
+}
+
+// NewRefillStack fills the buffer up to high pairs read from r and starts
+// refilling it in background until ctx is done or the stack is closed
+func NewRefillStack(ctx context.Context, r io.Reader, low, high int) (*RefillStack, error) {
+	if high <= 0 {
+		return nil, errInvalidDepth
+	}
+	if low < 0 || low > high {
+		return nil, errors.New("low watermark must be in range of 0 to high watermark")
+	}
+
+	s := &RefillStack{
+		Wait: DefaultRefillWait,
+		c:    make(chan lottery.Pair, high),
+		low:  low,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+		r:    r,
+	}
+	for i := 0; i < high; i++ {
+		var p lottery.Pair
+		if err := readEntropy(r, p[:]); err != nil {
+			return nil, err
+		}
+		s.c <- p
+	}
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	go s.refill()
+	return s, nil
+}
+
+// Pop returns a buffered pair. If the buffer is empty, Pop waits for the
+// refill up to Wait. Then *EntropyError is returned, holding the entropy
+// source error if any or ErrEmpty otherwise. Pop doesn't wait once the
+// source has failed
+func (s *RefillStack) Pop() (lottery.Pair, error) {
+	select {
+	case p := <-s.c:
+		return s.popped(p), nil
+	default:
+	}
+
+	if s.ctx.Err() != nil {
+		return lottery.Pair{}, errStopped
+	}
+	s.signal()
+
+	if err := s.sourceErr(); err != nil {
+		return lottery.Pair{}, err
+	}
+
+	t := time.NewTimer(s.Wait)
+	defer t.Stop()
+
+	select {
+	case p := <-s.c:
+		return s.popped(p), nil
+	case <-s.ctx.Done():
+		return lottery.Pair{}, errStopped
+	case <-t.C:
+	}
+
+	if err := s.sourceErr(); err != nil {
+		return lottery.Pair{}, err
+	}
+	return lottery.Pair{}, &EntropyError{Err: ErrEmpty}
+}
+
+// popped wakes up the refill goroutine if the buffer is below the low
+// watermark after pop of p
+func (s *RefillStack) popped(p lottery.Pair) lottery.Pair {
+	if len(s.c) < s.low {
+		s.signal()
+	}
+	return p
+}
+
+// Close stops the refill goroutine and waits for it to exit
+func (s *RefillStack) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// signal wakes up the refill goroutine
+func (s *RefillStack) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *RefillStack) sourceErr() error {
+	s.errL.Lock()
+	defer s.errL.Unlock()
+
+	return s.err
+}
+
+func (s *RefillStack) setErr(err error) {
+	s.errL.Lock()
+	s.err = err
+	s.errL.Unlock()
+}
+
+func (s *RefillStack) refill() {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.wake:
+		case <-s.ctx.Done():
+			return
+		}
+
+		// Only this goroutine sends, so sends below never block
+		for len(s.c) < cap(s.c) {
+			var p lottery.Pair
+			if err := readEntropy(s.r, p[:]); err != nil {
+				s.setErr(err)
+				select {
+				case <-time.After(refillRetryDelay):
+					continue
+				case <-s.ctx.Done():
+					return
+				}
+			}
+			s.setErr(nil)
+			s.c <- p
+		}
+	}
+}
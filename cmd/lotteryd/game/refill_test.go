@@ -0,0 +1,182 @@
+package game
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// eventually polls cond until it's true or timeout expires
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition isn't met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newRefillStack(t *testing.T, r io.Reader, low, high int) *RefillStack {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := NewRefillStack(ctx, r, low, high)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		s.Close()
+	})
+	return s
+}
+
+func TestRefillStack_Refill(t *testing.T) {
+	s := newRefillStack(t, &counterReader{}, 5, 10)
+
+	// Buffer isn't refilled until it drops below the low watermark
+	popN(t, s, 5)
+	time.Sleep(10 * time.Millisecond)
+	if n := len(s.c); n != 5 {
+		t.Fatalf("buffered %d pairs, want 5", n)
+	}
+
+	popN(t, s, 1)
+	eventually(t, func() bool { return len(s.c) == 10 })
+
+	// Pairs keep the order they're read in
+	for i, p := range popN(t, s, 10) {
+		if want := (lottery.Pair{0, byte(6 + i)}); p != want {
+			t.Errorf("RefillStack.Pop() #%d = %v, want %v", i, p, want)
+		}
+	}
+}
+
+// stallReader reads data and blocks once it's over, until unblocked
+type stallReader struct {
+	r       io.Reader
+	unblock chan struct{}
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		<-r.unblock
+	}
+	return n, err
+}
+
+func TestRefillStack_Stall(t *testing.T) {
+	r := &stallReader{r: bytes.NewReader(make([]byte, 20)), unblock: make(chan struct{})}
+	s := newRefillStack(t, r, 5, 10)
+	t.Cleanup(func() { close(r.unblock) })
+
+	s.Wait = 20 * time.Millisecond
+
+	popN(t, s, 10)
+
+	// Refill goroutine is stuck, Pop fails once the wait is over
+	start := time.Now()
+	_, err := s.Pop()
+	if !errors.Is(err, ErrEmpty) {
+		t.Errorf("RefillStack.Pop() error = %v, want %v", err, ErrEmpty)
+	}
+	if d := time.Since(start); d < s.Wait {
+		t.Errorf("RefillStack.Pop() returned after %v, want at least %v", d, s.Wait)
+	}
+}
+
+// slowReader delays every read
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.r.Read(p)
+}
+
+func TestRefillStack_Wait(t *testing.T) {
+	s := newRefillStack(t, &slowReader{r: &counterReader{}, delay: 5 * time.Millisecond}, 5, 10)
+
+	// Pop waits for the refill goroutine which is behind
+	for i := 0; i < 20; i++ {
+		if _, err := s.Pop(); err != nil {
+			t.Fatalf("RefillStack.Pop() #%d error = %v", i, err)
+		}
+	}
+}
+
+func TestRefillStack_EntropyFailure(t *testing.T) {
+	r := &testReader{r: &counterReader{}}
+	s := newRefillStack(t, r, 5, 10)
+
+	failure := errors.New("source is gone")
+	r.fail(failure)
+	popN(t, s, 10)
+
+	// The source error is reported, not just empty buffer
+	eventually(t, func() bool {
+		_, err := s.Pop()
+		var ee *EntropyError
+		return errors.As(err, &ee) && errors.Is(err, failure)
+	})
+
+	r.fail(nil)
+	eventually(t, func() bool {
+		_, err := s.Pop()
+		return err == nil
+	})
+}
+
+func TestRefillStack_Stop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := NewRefillStack(ctx, &counterReader{}, 5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case <-s.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("refill goroutine isn't stopped")
+	}
+
+	// Buffered pairs are still there
+	popN(t, s, 10)
+	if _, err := s.Pop(); err != errStopped {
+		t.Errorf("RefillStack.Pop() error = %v, want %v", err, errStopped)
+	}
+}
+
+func TestRefillStack_Close(t *testing.T) {
+	s, err := NewRefillStack(context.Background(), &counterReader{}, 5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("RefillStack.Close() error = %v", err)
+	}
+	select {
+	case <-s.done:
+	default:
+		t.Fatal("refill goroutine isn't stopped")
+	}
+
+	popN(t, s, 10)
+	if _, err := s.Pop(); err != errStopped {
+		t.Errorf("RefillStack.Pop() error = %v, want %v", err, errStopped)
+	}
+}
@@ -1,40 +1,57 @@
 package game
 
 import (
-	"crypto/rand"
+	"errors"
+	"io"
 
 	"github.com/bpiddubnyi/lottery"
 )
 
 const (
-	stackLen  = 100
-	stackSize = stackLen * 2
+	// DefaultDepth is the default number of pairs held by containers
+	DefaultDepth = 100
+)
+
+var (
+	errInvalidDepth = errors.New("depth must be positive")
 )
 
 type WinRing struct {
-	data [stackSize]byte
+	data []byte
 	cur  int
+	r    io.Reader
 }
 
+// Pop returns the next pair. If the entropy source fails, *EntropyError is
+// returned and the ring is left intact
 func (s *WinRing) Pop() (lottery.Pair, error) {
-	if s.cur+2 > stackSize {
+	if s.cur+2 > len(s.data) {
 		s.cur = 0
 	}
 
 	var win lottery.Pair
 	copy(win[:], s.data[s.cur:s.cur+2])
 
-	_, err := rand.Read(s.data[s.cur : s.cur+2])
-	if err == nil {
-		s.cur += 2
+	var newP lottery.Pair
+	err := readEntropy(s.r, newP[:])
+	if err != nil {
+		return lottery.Pair{}, err
 	}
+	copy(s.data[s.cur:s.cur+2], newP[:])
+	s.cur += 2
 
-	return win, err
+	return win, nil
 }
 
-func NewWinRing() (*WinRing, error) {
-	s := &WinRing{}
-	_, err := rand.Read(s.data[:])
+// NewWinRing creates win ring of depth pairs read from the entropy
+// source r, e.g. crypto/rand.Reader
+func NewWinRing(r io.Reader, depth int) (*WinRing, error) {
+	if depth <= 0 {
+		return nil, errInvalidDepth
+	}
+
+	s := &WinRing{data: make([]byte, depth*2), r: r}
+	err := readEntropy(r, s.data)
 	if err != nil {
 		return nil, err
 	}
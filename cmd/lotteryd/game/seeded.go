@@ -0,0 +1,40 @@
+package game
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// SeededStack is a deterministic lucky pair stack. Pairs are read from
+// AES-256-CTR keystream keyed with SHA-256 of the seed, so the same seed
+// always produces the same sequence of pairs. It's meant for reproducing
+// sessions and testing, the seed must be kept secret otherwise
+type SeededStack struct {
+	stream cipher.Stream
+}
+
+// NewSeededStack creates seeded stack. Seed may be of any non-zero length
+func NewSeededStack(seed []byte) (*SeededStack, error) {
+	if len(seed) == 0 {
+		return nil, errors.New("seed is empty")
+	}
+
+	key := sha256.Sum256(seed)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	return &SeededStack{stream: cipher.NewCTR(block, iv)}, nil
+}
+
+func (s *SeededStack) Pop() (lottery.Pair, error) {
+	var p lottery.Pair
+	s.stream.XORKeyStream(p[:], p[:])
+	return p, nil
+}
@@ -0,0 +1,54 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+func popN(t *testing.T, s PairStack, n int) []lottery.Pair {
+	t.Helper()
+
+	res := make([]lottery.Pair, n)
+	for i := range res {
+		p, err := s.Pop()
+		if err != nil {
+			t.Fatalf("Pop() error = %v", err)
+		}
+		res[i] = p
+	}
+	return res
+}
+
+func TestSeededStack_Pop(t *testing.T) {
+	tests := []struct {
+		name string
+		seed string
+		want []lottery.Pair
+	}{
+		{
+			name: "seed",
+			seed: "seed",
+			want: []lottery.Pair{{16, 36}, {224, 62}, {241, 103}, {33, 147}, {243, 150}},
+		},
+		{
+			name: "other seed",
+			seed: "other seed",
+			want: []lottery.Pair{{28, 189}, {222, 223}, {6, 139}, {186, 12}, {161, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSeededStack([]byte(tt.seed))
+			if err != nil {
+				t.Fatalf("NewSeededStack() error = %v", err)
+			}
+			got := popN(t, s, len(tt.want))
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("SeededStack.Pop() #%d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
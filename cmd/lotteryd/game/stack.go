@@ -2,31 +2,40 @@ package game
 
 import (
 	"container/list"
-	"crypto/rand"
 	"errors"
+	"io"
 
 	"github.com/bpiddubnyi/lottery"
 )
 
 type WinStack struct {
 	l *list.List
+	r io.Reader
 }
 
-func NewWinStack() (*WinStack, error) {
+// NewWinStack creates win stack of depth pairs read from the entropy
+// source r, e.g. crypto/rand.Reader
+func NewWinStack(r io.Reader, depth int) (*WinStack, error) {
+	if depth <= 0 {
+		return nil, errInvalidDepth
+	}
+
 	l := list.New()
-	for i := 0; i < stackLen; i++ {
+	for i := 0; i < depth; i++ {
 		var p lottery.Pair
 
-		_, err := rand.Read(p[:])
+		err := readEntropy(r, p[:])
 		if err != nil {
 			return nil, err
 		}
 
 		l.PushBack(p)
 	}
-	return &WinStack{l: l}, nil
+	return &WinStack{l: l, r: r}, nil
 }
 
+// Pop returns the next pair. If the entropy source fails, *EntropyError is
+// returned and the stack is left intact
 func (s *WinStack) Pop() (lottery.Pair, error) {
 	var p lottery.Pair
 
@@ -42,13 +51,13 @@ func (s *WinStack) Pop() (lottery.Pair, error) {
 	}
 
 	var newP lottery.Pair
-	_, err := rand.Read(newP[:])
+	err := readEntropy(s.r, newP[:])
 	if err != nil {
-		return p, err
+		return lottery.Pair{}, err
 	}
 
 	s.l.Remove(e)
-	s.l.PushBack(p)
+	s.l.PushBack(newP)
 
 	return p, nil
 }
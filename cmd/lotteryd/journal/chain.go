@@ -0,0 +1,210 @@
+package journal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// DefaultCheckpointEvery is the default number of entries between signed
+	// checkpoints
+	DefaultCheckpointEvery = 1000
+
+	// Context of checkpoint signatures, it keeps them from being valid
+	// in other protocols using the same key
+	checkpointContext = "lottery journal checkpoint v1"
+)
+
+// zeroHash is the previous hash of the first entry
+var zeroHash = strings.Repeat("0", 2*sha256.Size)
+
+// Entry is a line of the journal, holding either a play or a checkpoint.
+// Entries are chained: each one holds the hash of the previous one, so
+// editing, removing or reordering entries breaks the chain
+type Entry struct {
+	Seq        uint64      `json:"seq"`
+	Prev       string      `json:"prev"`
+	Play       *Record     `json:"play,omitempty"`
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	// SHA-256 of the entry encoded with empty Hash, hex
+	Hash string `json:"hash"`
+}
+
+// Checkpoint is an Ed25519 signature of the chain up to the checkpoint
+// entry, see checkpointMessage
+type Checkpoint struct {
+	Signature string `json:"signature"`
+}
+
+// hash returns the hash of the entry
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkpointMessage returns the message signed by a checkpoint with sequence
+// number seq following the entry with hash prev
+func checkpointMessage(seq uint64, prev string) ([]byte, error) {
+	h, err := hex.DecodeString(prev)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, 0, len(checkpointContext)+8+len(h))
+	msg = append(msg, checkpointContext...)
+	msg = append(msg, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(msg[len(checkpointContext):], seq)
+	return append(msg, h...), nil
+}
+
+func signCheckpoint(key ed25519.PrivateKey, seq uint64, prev string) (*Checkpoint, error) {
+	msg, err := checkpointMessage(seq, prev)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpoint{Signature: hex.EncodeToString(ed25519.Sign(key, msg))}, nil
+}
+
+// ChainError describes the first entry breaking the chain
+type ChainError struct {
+	// Index of the entry, counting from 0 over all verified input
+	Index  int
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("entry %d: %s", e.Index, e.Reason)
+}
+
+// Verifier checks the chain of journal entries. Journal files are passed to
+// Verify in order, so the chain is checked across rotations
+type Verifier struct {
+	// Public key checkpoints are verified with, signatures aren't checked
+	// if nil
+	Key ed25519.PublicKey
+	// Partial allows the first entry to continue a chain of entries which
+	// aren't verified, e.g. when older journal files are gone. Otherwise
+	// the chain must start with entry 1
+	Partial bool
+
+	// Number of entries and checkpoints verified
+	Entries     int
+	Checkpoints int
+	// Sequence number of the first entry, it's 1 unless the journal is
+	// verified partially
+	FirstSeq uint64
+	// Sequence number of the last checkpoint and the last entry
+	CheckpointSeq uint64
+	LastSeq       uint64
+
+	head string
+}
+
+// Verify checks entries read from r. It returns *ChainError for the first
+// entry breaking the chain
+func (v *Verifier) Verify(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	for {
+		var e Entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &ChainError{Index: v.Entries, Reason: fmt.Sprintf("invalid entry: %s", err)}
+		}
+		if err := v.check(&e); err != nil {
+			return &ChainError{Index: v.Entries, Reason: err.Error()}
+		}
+
+		if v.Entries == 0 {
+			v.FirstSeq = e.Seq
+		}
+		v.Entries++
+		v.LastSeq, v.head = e.Seq, e.Hash
+		if e.Checkpoint != nil {
+			v.Checkpoints++
+			v.CheckpointSeq = e.Seq
+		}
+	}
+}
+
+func (v *Verifier) check(e *Entry) error {
+	if (e.Play == nil) == (e.Checkpoint == nil) {
+		return fmt.Errorf("entry %d must hold either a play or a checkpoint", e.Seq)
+	}
+
+	hash, err := e.hash()
+	if err != nil {
+		return err
+	}
+	if hash != e.Hash {
+		return fmt.Errorf("entry %d hash mismatch: recorded %s, computed %s", e.Seq, e.Hash, hash)
+	}
+
+	switch {
+	case v.Entries > 0:
+		if e.Seq != v.LastSeq+1 {
+			return fmt.Errorf("entry %d follows entry %d", e.Seq, v.LastSeq)
+		}
+		if e.Prev != v.head {
+			return fmt.Errorf("entry %d previous hash %s doesn't match entry %d hash %s",
+				e.Seq, e.Prev, v.LastSeq, v.head)
+		}
+	case e.Seq == 0:
+		return fmt.Errorf("entry sequence numbers start at 1")
+	case e.Seq > 1 && !v.Partial:
+		return fmt.Errorf("chain starts at entry %d, entries 1-%d are missing", e.Seq, e.Seq-1)
+	case e.Seq == 1 && e.Prev != zeroHash:
+		return fmt.Errorf("first entry previous hash %s, want %s", e.Prev, zeroHash)
+	}
+
+	if e.Checkpoint != nil && v.Key != nil {
+		msg, err := checkpointMessage(e.Seq, e.Prev)
+		if err != nil {
+			return fmt.Errorf("invalid previous hash: %s", err)
+		}
+		sig, err := hex.DecodeString(e.Checkpoint.Signature)
+		if err != nil || !ed25519.Verify(v.Key, msg, sig) {
+			return fmt.Errorf("checkpoint %d signature is invalid", e.Seq)
+		}
+	}
+	return nil
+}
+
+// lastEntry returns the last entry of journal data. A torn line at the end
+// of data is ignored, its offset is returned as the end of data
+func lastEntry(data []byte) (*Entry, int, error) {
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if end == 0 {
+		return nil, 0, nil
+	}
+	start := bytes.LastIndexByte(data[:end-1], '\n') + 1
+
+	var e Entry
+	if err := json.Unmarshal(data[start:end], &e); err != nil {
+		return nil, end, fmt.Errorf("invalid last entry: %s", err)
+	}
+	hash, err := e.hash()
+	if err != nil {
+		return nil, end, err
+	}
+	if hash != e.Hash {
+		return nil, end, fmt.Errorf("last entry %d hash mismatch", e.Seq)
+	}
+	return &e, end, nil
+}
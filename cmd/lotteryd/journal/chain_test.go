@@ -0,0 +1,277 @@
+package journal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var testKey = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+
+// writeChain writes n plays to a new journal in dir and returns its lines
+func writeChain(t *testing.T, dir string, n int, key ed25519.PrivateKey) []string {
+	t.Helper()
+
+	path := filepath.Join(dir, "journal")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Key = key
+	j.CheckpointEvery = 3
+	for i := 0; i < n; i++ {
+		if err := j.Write(testRecord(i)); err != nil {
+			t.Fatalf("Journal.Write() error = %v", err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.SplitAfter(string(data), "\n")
+}
+
+// rechain recomputes hashes of entries starting from i, like an attacker
+// without the signing key could do
+func rechain(t *testing.T, lines []string, i int) {
+	t.Helper()
+
+	var prev Entry
+	if i > 0 {
+		if err := json.Unmarshal([]byte(lines[i-1]), &prev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for ; i < len(lines) && lines[i] != ""; i++ {
+		var e Entry
+		if err := json.Unmarshal([]byte(lines[i]), &e); err != nil {
+			t.Fatal(err)
+		}
+		if prev.Hash != "" {
+			e.Seq, e.Prev = prev.Seq+1, prev.Hash
+		}
+		e.Hash, _ = e.hash()
+		data, _ := json.Marshal(e)
+		lines[i] = string(data) + "\n"
+		prev = e
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 7 plays with checkpoints after every 3 and on close: entries 3, 7
+	// and 10 are checkpoints
+	lines := writeChain(t, dir, 7, testKey)
+	if len(lines) != 11 || lines[10] != "" {
+		t.Fatalf("journal has %d lines, want 10", len(lines)-1)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(lines []string)
+		// Verify without the key
+		noKey bool
+		// Verify a partial chain
+		partial   bool
+		wantIndex int
+	}{
+		{
+			name:      "intact",
+			tamper:    func([]string) {},
+			wantIndex: -1,
+		},
+		{
+			name: "edited",
+			tamper: func(lines []string) {
+				lines[4] = strings.Replace(lines[4], `"fee":3`, `"fee":300`, 1)
+			},
+			wantIndex: 4,
+		},
+		{
+			name: "edited with hash",
+			tamper: func(lines []string) {
+				lines[4] = strings.Replace(lines[4], `"fee":3`, `"fee":300`, 1)
+				rechain(t, lines[:5], 4)
+			},
+			wantIndex: 5,
+		},
+		{
+			name: "removed",
+			tamper: func(lines []string) {
+				copy(lines[4:], lines[5:])
+				lines[len(lines)-1] = ""
+			},
+			wantIndex: 4,
+		},
+		{
+			name: "leading removed",
+			tamper: func(lines []string) {
+				copy(lines, lines[2:])
+				lines[len(lines)-2], lines[len(lines)-1] = "", ""
+			},
+			wantIndex: 0,
+		},
+		{
+			name: "leading removed partial",
+			tamper: func(lines []string) {
+				copy(lines, lines[2:])
+				lines[len(lines)-2], lines[len(lines)-1] = "", ""
+			},
+			partial:   true,
+			wantIndex: -1,
+		},
+		{
+			name: "reordered",
+			tamper: func(lines []string) {
+				lines[4], lines[5] = lines[5], lines[4]
+			},
+			wantIndex: 4,
+		},
+		{
+			name: "rechained after edit",
+			tamper: func(lines []string) {
+				lines[4] = strings.Replace(lines[4], `"fee":3`, `"fee":300`, 1)
+				rechain(t, lines, 4)
+			},
+			wantIndex: 7,
+		},
+		{
+			name: "rechained after edit without key",
+			tamper: func(lines []string) {
+				lines[4] = strings.Replace(lines[4], `"fee":3`, `"fee":300`, 1)
+				rechain(t, lines, 4)
+			},
+			noKey:     true,
+			wantIndex: -1,
+		},
+		{
+			name: "unknown field",
+			tamper: func(lines []string) {
+				lines[2] = strings.Replace(lines[2], `"seq"`, `"note":"x","seq"`, 1)
+			},
+			wantIndex: 2,
+		},
+		{
+			name: "garbage",
+			tamper: func(lines []string) {
+				lines[6] = "garbage\n"
+			},
+			wantIndex: 6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := append([]string(nil), lines...)
+			tt.tamper(tampered)
+
+			v := &Verifier{Key: testKey.Public().(ed25519.PublicKey), Partial: tt.partial}
+			if tt.noKey {
+				v.Key = nil
+			}
+			err := v.Verify(strings.NewReader(strings.Join(tampered, "")))
+
+			var ce *ChainError
+			if tt.wantIndex < 0 {
+				if err != nil {
+					t.Errorf("Verifier.Verify() error = %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &ce) {
+				t.Fatalf("Verifier.Verify() error = %v, want *ChainError", err)
+			}
+			if ce.Index != tt.wantIndex {
+				t.Errorf("Verifier.Verify() error = %v, want index %d", err, tt.wantIndex)
+			}
+		})
+	}
+}
+
+func TestJournal_Chain(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	// Chain continues over reopens, rotations and a torn entry
+	for i := 0; i < 3; i++ {
+		j, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		j.Key = testKey
+		j.CheckpointEvery = 4
+		j.MaxSize = 1000
+		for k := 0; k < 5; k++ {
+			if err := j.Write(testRecord(k)); err != nil {
+				t.Fatalf("Journal.Write() error = %v", err)
+			}
+		}
+		j.Close()
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(`{"seq":`)
+		f.Close()
+	}
+	// A reopen right after rotation starts with an empty file
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.rotate()
+	j.Close()
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Key = testKey
+	if err := j.Write(testRecord(0)); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	paths, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	paths = append(paths, path)
+
+	v := &Verifier{Key: testKey.Public().(ed25519.PublicKey)}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = v.Verify(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: Verifier.Verify() error = %v", p, err)
+		}
+	}
+	// 16 plays, a checkpoint after 4 plays and one on close for every run,
+	// and one on close of the last run
+	if v.Entries != 16+3*2+1 || v.LastSeq != uint64(v.Entries) || v.CheckpointSeq != v.LastSeq {
+		t.Errorf("verified %d entries, last %d, last checkpoint %d", v.Entries, v.LastSeq, v.CheckpointSeq)
+	}
+}
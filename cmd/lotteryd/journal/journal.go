@@ -0,0 +1,355 @@
+// Package journal records completed plays in an append-only file, one JSON
+// entry per line:
+//
+//	{"seq":1,"prev":"0000…0000","play":{"time":"2026-10-17T19:32:28.123456789Z","remote":"127.0.0.1:40038","uuid":"7cef13fa-ca61-11f1-9638-aa4918e89e8f","fee":150,"guess":"228:26","draw":"12:200","type":"nowin","jackpot_before":0,"jackpot_after":150,"delivered":true},"hash":"9c1e…"}
+//	{"seq":2,"prev":"9c1e…","checkpoint":{"signature":"5b2a…"},"hash":"e0f4…"}
+//
+// Entries are hash-chained, and if a key is set, the chain is signed by a
+// checkpoint entry periodically and on close. Verifier detects edited,
+// removed and reordered entries.
+//
+// Once the file grows over the size limit, it's renamed with the rotation
+// time appended to its name and a new file is started. The chain continues
+// in the new file. Rotated files are never removed.
+package journal
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMaxSize is the default size of a journal file which makes it
+	// rotate, in bytes
+	DefaultMaxSize = 64 << 20
+
+	// Suffix of rotated files
+	rotateTimeFormat = "20060102T150405.000000000Z"
+)
+
+// SyncPolicy defines when records are flushed to stable storage
+type SyncPolicy int
+
+// Sync policies
+const (
+	// SyncAlways syncs the file after every record
+	SyncAlways SyncPolicy = iota
+	// SyncInterval syncs the file on the first write after Interval has
+	// passed since the last sync
+	SyncInterval
+	// SyncNever leaves flushing to the OS
+	SyncNever
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncInterval:
+		return "interval"
+	case SyncNever:
+		return "never"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSyncPolicy parses sync policy name, it's the inverse of
+// SyncPolicy.String
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch s {
+	case "always":
+		return SyncAlways, nil
+	case "interval":
+		return SyncInterval, nil
+	case "never":
+		return SyncNever, nil
+	default:
+		return 0, fmt.Errorf("invalid sync policy: '%s'", s)
+	}
+}
+
+// Record describes a completed play
+type Record struct {
+	Time          time.Time            `json:"time"`
+	Remote        string               `json:"remote"`
+	UUID          uuid.UUID            `json:"uuid"`
+	Fee           uint64               `json:"fee"`
+	Guess         lottery.Pair         `json:"guess"`
+	Draw          lottery.Pair         `json:"draw"`
+	Type          lottery.ResponseType `json:"type"`
+	JackpotBefore uint64               `json:"jackpot_before"`
+	JackpotAfter  uint64               `json:"jackpot_after"`
+	// Whether the response has been sent to the player
+	Delivered bool `json:"delivered"`
+}
+
+// Journal is an append-only play journal. Journal is safe for concurrent use
+type Journal struct {
+	// Sync policy and interval of SyncInterval policy
+	Sync     SyncPolicy
+	Interval time.Duration
+	// Size of the file which makes it rotate, 0 disables rotation
+	MaxSize int64
+	// Checkpoint signing key, checkpoints aren't written if nil
+	Key ed25519.PrivateKey
+	// Number of entries between checkpoints
+	CheckpointEvery int
+
+	path string
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	lastSync time.Time
+	// Size at which rotation is retried after a failure, 0 if it hasn't
+	// failed
+	retrySize int64
+	// Write failure, the file may end with a torn entry after it, so
+	// no more entries are written
+	err error
+
+	// Sequence number and hash of the last entry
+	seq  uint64
+	head string
+	// Number of entries since the last checkpoint
+	unsigned int
+}
+
+// Open opens the journal at path for appending, creating it if needed. The
+// chain is continued from the last entry of the journal. A torn entry left
+// at the end of the file by a crash is removed
+func Open(path string) (*Journal, error) {
+	j := &Journal{
+		Sync:            SyncAlways,
+		Interval:        time.Second,
+		MaxSize:         DefaultMaxSize,
+		CheckpointEvery: DefaultCheckpointEvery,
+		path:            path,
+		head:            zeroHash,
+	}
+	if err := j.recover(); err != nil {
+		return nil, err
+	}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// recover finds the last entry of the journal, in the current file or in the
+// latest rotated one if the current file is empty
+func (j *Journal) recover() error {
+	rotated, err := filepath.Glob(j.path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(rotated)
+	paths := append(rotated, j.path)
+
+	for i := len(paths) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(paths[i])
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		e, end, err := lastEntry(data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", paths[i], err)
+		}
+		if end < len(data) {
+			if i != len(paths)-1 {
+				return fmt.Errorf("%s: torn entry at offset %d", paths[i], end)
+			}
+			log.Printf("warning: journal: removing torn entry at offset %d of %s", end, j.path)
+			if err := os.Truncate(j.path, int64(end)); err != nil {
+				return err
+			}
+		}
+		if e != nil {
+			j.seq, j.head = e.Seq, e.Hash
+			return nil
+		}
+	}
+	return nil
+}
+
+func (j *Journal) open() error {
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	j.f, j.size, j.lastSync = f, fi.Size(), time.Now()
+	return nil
+}
+
+// Write appends the record to the journal. Once CheckpointEvery records
+// are written since the last checkpoint, it's followed by a checkpoint
+func (j *Journal) Write(r *Record) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.write(&Entry{Play: r}); err != nil {
+		return err
+	}
+	j.unsigned++
+
+	if j.Key != nil && j.unsigned >= j.CheckpointEvery {
+		return j.checkpoint()
+	}
+	return nil
+}
+
+// checkpoint appends a checkpoint entry signing the chain
+func (j *Journal) checkpoint() error {
+	cp, err := signCheckpoint(j.Key, j.seq+1, j.head)
+	if err != nil {
+		return err
+	}
+	if err := j.write(&Entry{Checkpoint: cp}); err != nil {
+		return err
+	}
+	j.unsigned = 0
+	return nil
+}
+
+// write chains the entry to the last one and appends it
+func (j *Journal) write(e *Entry) error {
+	if j.f == nil {
+		return os.ErrClosed
+	}
+	if j.err != nil {
+		return j.err
+	}
+
+	e.Seq, e.Prev = j.seq+1, j.head
+	hash, err := e.hash()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if j.MaxSize > 0 && j.size > 0 && j.size+int64(len(data)) > j.MaxSize && j.size >= j.retrySize {
+		if err := j.rotate(); err != nil {
+			// Don't retry on every write, until the file grows by
+			// another MaxSize
+			j.retrySize = j.size + j.MaxSize
+			log.Printf("warning: journal: failed to rotate %s, retrying at %d bytes: %s", j.path, j.retrySize, err)
+		} else {
+			j.retrySize = 0
+		}
+	}
+
+	n, err := j.f.Write(data)
+	j.size += int64(n)
+	if err != nil {
+		j.err = fmt.Errorf("failed to write journal: %s", err)
+		return j.err
+	}
+	j.seq, j.head = e.Seq, e.Hash
+
+	switch j.Sync {
+	case SyncAlways:
+		return j.sync()
+	case SyncInterval:
+		if time.Since(j.lastSync) >= j.Interval {
+			return j.sync()
+		}
+	}
+	return nil
+}
+
+func (j *Journal) sync() error {
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.lastSync = time.Now()
+	return nil
+}
+
+// rotate renames the current file and starts a new one. On failure records
+// keep being appended to the current file
+func (j *Journal) rotate() error {
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+
+	name := j.path + "." + time.Now().UTC().Format(rotateTimeFormat)
+	if _, err := os.Stat(name); err == nil {
+		return fmt.Errorf("rotated journal %s already exists", name)
+	}
+	if err := os.Rename(j.path, name); err != nil {
+		return err
+	}
+
+	old := j.f
+	if err := j.open(); err != nil {
+		return err
+	}
+	cerr := old.Close()
+
+	// Make both the rename and the new file durable
+	if err := syncDir(filepath.Dir(j.path)); err != nil {
+		return err
+	}
+	return cerr
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Close signs the chain if there are unsigned entries, syncs and closes
+// the journal
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return os.ErrClosed
+	}
+
+	var err error
+	if j.Key != nil && j.unsigned > 0 {
+		err = j.checkpoint()
+	}
+	if serr := j.f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	j.f = nil
+	return err
+}
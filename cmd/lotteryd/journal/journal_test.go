@@ -0,0 +1,190 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/google/uuid"
+)
+
+var testUUID, _ = uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+
+func testRecord(i int) *Record {
+	return &Record{
+		Time:          time.Date(2026, 10, 17, 12, 0, i, 0, time.UTC),
+		Remote:        "127.0.0.1:40000",
+		UUID:          testUUID,
+		Fee:           uint64(i),
+		Guess:         lottery.Pair{1, 2},
+		Draw:          lottery.Pair{12, 200},
+		Type:          lottery.NoWin,
+		JackpotBefore: 100,
+		JackpotAfter:  100 + uint64(i),
+		Delivered:     i%2 == 0,
+	}
+}
+
+// readRecords reads play records from journal files in order
+func readRecords(t *testing.T, paths ...string) []Record {
+	t.Helper()
+
+	var recs []Record
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var e Entry
+			if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+				t.Fatalf("%s: invalid entry %q: %v", path, sc.Text(), err)
+			}
+			if e.Play != nil {
+				recs = append(recs, *e.Play)
+			}
+		}
+		f.Close()
+	}
+	return recs
+}
+
+func TestJournal_Write(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	// Reopened journal is appended to
+	for i := 0; i < 4; i++ {
+		j, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.Sync = SyncPolicy(i % 3)
+		if err := j.Write(testRecord(i)); err != nil {
+			t.Fatalf("Journal.Write() error = %v", err)
+		}
+		if err := j.Close(); err != nil {
+			t.Fatalf("Journal.Close() error = %v", err)
+		}
+	}
+
+	recs := readRecords(t, path)
+	if len(recs) != 4 {
+		t.Fatalf("%d records, want 4", len(recs))
+	}
+	for i, r := range recs {
+		if want := testRecord(i); r != *want {
+			t.Errorf("record #%d = %+v, want %+v", i, r, *want)
+		}
+	}
+}
+
+func TestJournal_Rotate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Room for 2 entries per file
+	data, _ := json.Marshal(&Entry{Seq: 1, Prev: zeroHash, Play: testRecord(0), Hash: zeroHash})
+	j.MaxSize = int64(2*len(data) + 10)
+
+	const n = 7
+	for i := 0; i < n; i++ {
+		if err := j.Write(testRecord(i)); err != nil {
+			t.Fatalf("Journal.Write() error = %v", err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 3 {
+		t.Errorf("%d rotated files, want 3: %v", len(rotated), rotated)
+	}
+
+	// Rotation time suffix keeps files in order
+	sort.Strings(rotated)
+	recs := readRecords(t, append(rotated, path)...)
+	if len(recs) != n {
+		t.Fatalf("%d records, want %d", len(recs), n)
+	}
+	for i, r := range recs {
+		if r.Fee != uint64(i) {
+			t.Errorf("record #%d fee = %d, want %d", i, r.Fee, i)
+		}
+	}
+}
+
+func TestJournal_RotateFailure(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := Open(filepath.Join(dir, "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	data, _ := json.Marshal(&Entry{Seq: 1, Prev: zeroHash, Play: testRecord(0), Hash: zeroHash})
+	j.MaxSize = int64(2*len(data) + 10)
+
+	// Rename fails once the directory is gone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	for i := 0; i < 9; i++ {
+		if err := j.Write(testRecord(i)); err != nil {
+			t.Fatalf("Journal.Write() #%d error = %v", i, err)
+		}
+	}
+
+	// Rotation is retried once the file grows by another MaxSize: on
+	// writes 3, 6 and 9
+	if n := strings.Count(buf.String(), "failed to rotate"); n != 3 {
+		t.Errorf("%d failed rotations, want 3:\n%s", n, buf.String())
+	}
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	for _, p := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		got, err := ParseSyncPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseSyncPolicy(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseSyncPolicy("sometimes"); err == nil {
+		t.Errorf("ParseSyncPolicy(\"sometimes\") error = nil, want error")
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -13,35 +19,126 @@ import (
 	"time"
 
 	"github.com/bpiddubnyi/lottery/cmd/lotteryd/game"
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/journal"
 	"github.com/bpiddubnyi/lottery/cmd/lotteryd/server"
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/state"
+	"github.com/bpiddubnyi/lottery/encoding"
+	"github.com/bpiddubnyi/lottery/encoding/auth"
+	"github.com/bpiddubnyi/lottery/encoding/framed"
+	"github.com/bpiddubnyi/lottery/encoding/signed"
+
+	// Supported protocols
+	_ "github.com/bpiddubnyi/lottery/encoding/binary"
+	_ "github.com/bpiddubnyi/lottery/encoding/jsonl"
+	_ "github.com/bpiddubnyi/lottery/encoding/line"
+	_ "github.com/bpiddubnyi/lottery/encoding/plain"
 )
 
 var (
 	timeout   = 5
+	session   = 300
 	workers   = uint(runtime.NumCPU())
 	showHelp  bool
 	addr      = ":9876"
 	container = "stack"
+	proto     = "plain"
+	maxFrame  int
+	certFile  string
+	keyFile   string
+	clientCA  string
+	allow     string
+	authKeys  string
+	signKey   string
+	rotate    = uint64(game.DefaultRotate)
+	seed      string
+	entropy   = "os"
+	health    bool
+	depth     = game.DefaultDepth
+	refillLow int
+	limits    game.Limits
+	stateDir  string
+	force     bool
+
+	journalFile    string
+	journalSync    = journal.SyncAlways.String()
+	journalMaxSize = int64(journal.DefaultMaxSize)
+	journalKey     string
+	checkpoint     = journal.DefaultCheckpointEvery
 )
 
 func init() {
 	flag.UintVar(&workers, "w", workers, "number of workers")
 	flag.BoolVar(&showHelp, "h", false, "show this help and exit")
-	flag.IntVar(&timeout, "t", timeout, "connection timeout in seconds")
+	flag.IntVar(&timeout, "t", timeout, "connection timeout in seconds, idle timeout for line protocol")
+	flag.IntVar(&session, "session-timeout", session, "total connection time limit of line protocol in seconds")
 	flag.StringVar(&addr, "a", addr, "listen address")
-	flag.StringVar(&container, "c", container, "lucky pair container type (stack, ring)")
+	flag.StringVar(&container, "c", container, "lucky pair container type (stack, ring, atomic, jit, refill, fair, seeded)")
+	flag.IntVar(&depth, "depth", depth,
+		"number of pairs held by stack, ring and atomic containers, high watermark of refill container")
+	flag.IntVar(&refillLow, "refill-low", refillLow,
+		"low watermark of refill container, half of -depth if 0")
+	flag.Uint64Var(&rotate, "fair-rotate", rotate, "number of draws per server seed of fair container")
+	flag.StringVar(&entropy, "entropy", entropy,
+		"entropy source of stack, ring, atomic, jit and refill containers: os, or path to a file or FIFO")
+	flag.BoolVar(&health, "health", health,
+		"run continuous RNG health tests of -entropy source and drawn pairs, plays are disabled once a test fails")
+	flag.StringVar(&seed, "seed", seed, "hex encoded seed of seeded container, it yields the same pairs every run")
+	flag.Uint64Var(&limits.MinFee, "min-fee", limits.MinFee, "minimum play fee")
+	flag.Uint64Var(&limits.MaxFee, "max-fee", limits.MaxFee, "maximum play fee, 0 means no limit")
+	flag.Uint64Var(&limits.MaxJackpot, "max-jackpot", limits.MaxJackpot,
+		"jackpot cap, losing plays which would exceed it are rejected, 0 means no limit")
+	flag.StringVar(&stateDir, "state", stateDir,
+		"directory of persistent game state, the jackpot is kept in memory only if empty")
+	flag.BoolVar(&force, "force", force, "start even if game state is corrupt, discarding the damaged part")
+	flag.StringVar(&journalFile, "journal", journalFile, "play journal file, plays aren't journaled if empty")
+	flag.StringVar(&journalSync, "journal-sync", journalSync,
+		"journal sync policy: always, never, or sync interval like 1s")
+	flag.Int64Var(&journalMaxSize, "journal-max-size", journalMaxSize,
+		"journal file size in bytes which makes it rotate, 0 disables rotation")
+	flag.StringVar(&journalKey, "journal-key", journalKey,
+		"Ed25519 private key PEM file, enables signed journal checkpoints")
+	flag.IntVar(&checkpoint, "journal-checkpoint", checkpoint, "number of journal entries between signed checkpoints")
+	flag.StringVar(&proto, "p", proto,
+		fmt.Sprintf("default protocol for clients without preamble (%s)",
+			strings.Join(encoding.Names(), ", ")))
+	flag.IntVar(&maxFrame, "F", maxFrame,
+		"wrap messages into length-prefixed frames of given max size, 0 disables framing")
+	flag.StringVar(&certFile, "cert", certFile, "TLS certificate file, enables TLS")
+	flag.StringVar(&keyFile, "key", keyFile, "TLS private key file")
+	flag.StringVar(&clientCA, "client-ca", clientCA,
+		"CA bundle file to verify client certificates, enables mutual TLS")
+	flag.StringVar(&allow, "allow", allow,
+		"comma separated client certificate CNs or URIs allowed to play, requires -client-ca")
+	flag.StringVar(&authKeys, "auth-keys", authKeys,
+		"player key file, enables HMAC request authentication (reloaded on SIGHUP)")
+	flag.StringVar(&signKey, "sign-key", signKey,
+		"Ed25519 private key PEM file, enables signed responses")
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags]\n", os.Args[0])
+	fmt.Fprintf(out, "       %s audit verify [audit flags] journal...\n", os.Args[0])
+	flag.PrintDefaults()
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 	if showHelp {
 		flag.Usage()
 		return
 	}
 
-	con, err := getPairContainer(container)
-	if err != nil {
-		fmt.Printf("failed to initialize game lucky pair container: %s\n", err)
+	if flag.Arg(0) == "audit" {
+		if err := audit(flag.Args()[1:]); err != nil {
+			log.Fatalf("fatal: audit failed: %s", err)
+		}
+		return
+	}
+
+	if limits.MaxFee != 0 && limits.MinFee > limits.MaxFee {
+		fmt.Printf("minimum fee %d exceeds maximum of %d\n", limits.MinFee, limits.MaxFee)
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -57,23 +154,246 @@ func main() {
 		cancel()
 	}()
 
+	src, err := getEntropySource(entropy)
+	if err != nil {
+		fmt.Printf("failed to open entropy source: %s\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if health {
+		src = game.NewHealthReader(src, game.DefaultMinEntropy)
+	}
+
+	// Background refill stops along with the server
+	con, err := getPairContainer(ctx, container, src)
+	if err != nil {
+		fmt.Printf("failed to initialize game lucky pair container: %s\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if health {
+		con = game.NewLocked(game.NewMonitor(con, game.DefaultMonitorWindow))
+	}
+
+	codec, err := encoding.Lookup(proto)
+	if err != nil {
+		fmt.Printf("failed to initialize protocol: %s\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	tlsConf, err := getTLSConfig(certFile, keyFile, clientCA)
+	if err == nil && allow != "" && clientCA == "" {
+		err = errors.New("client identity allowlist requires client CA")
+	}
+	if err != nil {
+		fmt.Printf("failed to initialize TLS: %s\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var keys *auth.KeyStore
+	if authKeys != "" {
+		keys, err = auth.LoadKeyStore(authKeys)
+		if err != nil {
+			fmt.Printf("failed to load auth keys: %s\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		log.Printf("info: auth keys loaded: %d keys", keys.Len())
+		go reloadKeysOnHUP(keys)
+	}
+
+	var key ed25519.PrivateKey
+	if signKey != "" {
+		key, err = signed.LoadPrivateKey(signKey)
+		if err != nil {
+			fmt.Printf("failed to load signing key: %s\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	var st *state.Store
+	if stateDir != "" {
+		st, err = state.Open(stateDir, force)
+		if err != nil {
+			fmt.Printf("failed to open game state: %s\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		log.Printf("info: state: jackpot restored: %d", st.Jackpot())
+	}
+
+	var jrnl *journal.Journal
+	if journalFile != "" {
+		jrnl, err = openJournal(journalFile, journalSync, journalMaxSize)
+		if err != nil {
+			fmt.Printf("failed to open play journal: %s\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		if journalKey != "" {
+			jrnl.Key, err = signed.LoadPrivateKey(journalKey)
+			if err == nil && checkpoint <= 0 {
+				err = errors.New("number of entries between checkpoints must be positive")
+			}
+			if err != nil {
+				fmt.Printf("failed to initialize journal checkpoints: %s\n", err)
+				flag.Usage()
+				os.Exit(1)
+			}
+			jrnl.CheckpointEvery = checkpoint
+		}
+	}
+
 	s := server.New(con)
 
 	s.Timeout = time.Duration(timeout) * time.Second
+	s.SessionTimeout = time.Duration(session) * time.Second
 	s.Workers = workers
+	s.Proto = codec.Server
+	s.TLSConfig = tlsConf
+	if allow != "" {
+		s.Allow = strings.Split(allow, ",")
+	}
+	s.Wrap = getProtoWrapper(keys, key)
+	s.SetLimits(limits)
+	s.State = st
+	s.Journal = jrnl
 
 	if err := s.Listen(ctx, addr); err != nil {
 		log.Printf("error: server failed: %s", err)
 	}
+
+	// Fair container reveals its seed on close, refill one stops refilling
+	if c, ok := con.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("error: failed to close lucky pair container: %s", err)
+		}
+	}
+
+	if st != nil {
+		if err := st.Close(); err != nil {
+			log.Printf("error: failed to close game state: %s", err)
+		}
+	}
+	if jrnl != nil {
+		if err := jrnl.Close(); err != nil {
+			log.Printf("error: failed to close play journal: %s", err)
+		}
+	}
+}
+
+// getProtoWrapper returns protocol decorator enabled by command line flags
+func getProtoWrapper(keys *auth.KeyStore, key ed25519.PrivateKey) func(encoding.Server) encoding.Server {
+	var verifier *auth.Verifier
+	if keys != nil {
+		// Verifier is shared to detect requests replayed on other connections
+		verifier = auth.NewVerifier(keys)
+	}
+
+	return func(p encoding.Server) encoding.Server {
+		if key != nil {
+			p = signed.NewServer(p, key)
+		}
+		if verifier != nil {
+			p = auth.NewServer(p, verifier)
+		}
+		if maxFrame > 0 {
+			p = framed.NewServer(p, maxFrame)
+		}
+		return p
+	}
+}
+
+func reloadKeysOnHUP(keys *auth.KeyStore) {
+	hupC := make(chan os.Signal, 1)
+	signal.Notify(hupC, syscall.SIGHUP)
+
+	for range hupC {
+		if err := keys.Reload(); err != nil {
+			log.Printf("error: failed to reload auth keys: %s", err)
+			continue
+		}
+		log.Printf("info: auth keys reloaded: %d keys", keys.Len())
+	}
+}
+
+// getEntropySource returns OS randomness for "os" and a reader of the file
+// otherwise. The file is kept open until exit. Returned reader is safe for
+// concurrent use
+func getEntropySource(s string) (io.Reader, error) {
+	if s == "os" {
+		return rand.Reader, nil
+	}
+
+	f, err := os.Open(s)
+	if err != nil {
+		return nil, err
+	}
+	return game.NewSyncReader(bufio.NewReader(f)), nil
 }
 
-func getPairContainer(s string) (game.PairStack, error) {
+func getPairContainer(ctx context.Context, s string, entropy io.Reader) (game.PairStack, error) {
 	switch strings.ToLower(s) {
 	case "stack":
-		return game.NewWinStack()
+		return locked(game.NewWinStack(entropy, depth))
 	case "ring":
-		return game.NewWinRing()
+		return locked(game.NewWinRing(entropy, depth))
+	case "atomic":
+		return game.NewAtomicRing(entropy, depth)
+	case "jit":
+		return game.NewJITStack(entropy), nil
+	case "refill":
+		low := refillLow
+		if low == 0 {
+			low = depth / 2
+		}
+		return game.NewRefillStack(ctx, entropy, low, depth)
+	case "fair":
+		return locked(game.NewFairStack(rotate))
+	case "seeded":
+		b, err := hex.DecodeString(seed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seed: %s", err)
+		}
+		log.Printf("warning: seeded container draws predictable pairs, it must not be used in production")
+		return locked(game.NewSeededStack(b))
 	default:
 		return nil, fmt.Errorf("invalid value \"%s\"", s)
 	}
 }
+
+// openJournal opens play journal. Sync is a policy name or an interval
+func openJournal(path, sync string, maxSize int64) (*journal.Journal, error) {
+	policy, err := journal.ParseSyncPolicy(sync)
+	var interval time.Duration
+	if err != nil {
+		if interval, err = time.ParseDuration(sync); err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid sync policy: '%s'", sync)
+		}
+		policy = journal.SyncInterval
+	}
+
+	j, err := journal.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	j.Sync = policy
+	if interval > 0 {
+		j.Interval = interval
+	}
+	j.MaxSize = maxSize
+	return j, nil
+}
+
+// locked wraps containers which aren't safe for concurrent use
+func locked(s game.PairStack, err error) (game.PairStack, error) {
+	if err != nil {
+		return nil, err
+	}
+	return game.NewLocked(s), nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"crypto/tls"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// Identity is a client identity derived from a verified TLS client certificate
+type Identity struct {
+	// Subject common name
+	CN string
+	// URI subject alternative names, e.g. SPIFFE IDs
+	URIs []string
+}
+
+// peerIdentity returns identity of the verified client certificate or nil if
+// the client didn't present one
+func peerIdentity(cs tls.ConnectionState) *Identity {
+	if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := cs.VerifiedChains[0][0]
+	id := &Identity{CN: cert.Subject.CommonName}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+	return id
+}
+
+// String returns the first URI SAN, which is the SPIFFE ID for SPIFFE
+// certificates, or subject CN otherwise
+func (id *Identity) String() string {
+	if len(id.URIs) != 0 {
+		return id.URIs[0]
+	}
+	return id.CN
+}
+
+// Match reports whether subject CN or any of URI SANs is equal to name
+func (id *Identity) Match(name string) bool {
+	if id.CN != "" && id.CN == name {
+		return true
+	}
+	for _, u := range id.URIs {
+		if u == name {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize checks the client identity against the allowlist
+func (s *Server) authorize(id *Identity) error {
+	if len(s.Allow) == 0 {
+		return nil
+	}
+
+	if id != nil {
+		for _, name := range s.Allow {
+			if id.Match(name) {
+				return nil
+			}
+		}
+	}
+
+	msg := "client certificate required"
+	if id != nil {
+		msg = "identity " + id.String() + " is not allowed"
+	}
+	return &lottery.ServerError{Code: lottery.CodeUnauthorized, Message: msg}
+}
@@ -1,8 +1,12 @@
 package server
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"sync"
@@ -10,13 +14,20 @@ import (
 
 	"github.com/bpiddubnyi/lottery"
 	"github.com/bpiddubnyi/lottery/cmd/lotteryd/game"
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/journal"
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/state"
 	"github.com/bpiddubnyi/lottery/encoding"
 	"github.com/bpiddubnyi/lottery/encoding/plain"
 )
 
 const (
-	defaultTimeout = 10 * time.Second
-	defaultWorkers = 10
+	defaultTimeout        = 10 * time.Second
+	defaultSessionTimeout = 5 * time.Minute
+	defaultWorkers        = 10
+
+	// Number of malformed messages skipped in a session before the
+	// connection is closed
+	maxSkipped = 10
 )
 
 var (
@@ -24,37 +35,75 @@ var (
 )
 
 type Server struct {
-	// Protocol implementation
+	// Protocol implementation used by clients that don't send
+	// connection preamble
 	Proto encoding.Server
-	// Connection timeout
+	// Optional decorator applied to the negotiated protocol
+	Wrap func(encoding.Server) encoding.Server
+	// Connection timeout. Connections of interactive codecs time out
+	// after being idle that long, see encoding.Interactive
 	Timeout time.Duration
+	// Total time limit of interactive codec connections
+	SessionTimeout time.Duration
 	// Number of worker routines
 	Workers uint
+	// TLS configuration, connections are not encrypted if nil
+	TLSConfig *tls.Config
+	// Client identities allowed to play, see Identity.Match. Any client
+	// is allowed if empty
+	Allow []string
+	// Optional persistent state, the jackpot is restored from it when
+	// serving starts and saved after every play
+	State *state.Store
+	// Optional journal of completed plays
+	Journal *journal.Journal
 
-	game  *game.Game
-	gameL sync.Mutex
+	game *game.Game
 }
 
+// New creates server playing the game with stack. Stack must be safe for
+// concurrent use, see game.Locked
 func New(stack game.PairStack) *Server {
 	return &Server{
-		Timeout: defaultTimeout,
-		Workers: defaultWorkers,
-		Proto:   defaultProtocol,
-		game:    game.New(stack),
+		Timeout:        defaultTimeout,
+		SessionTimeout: defaultSessionTimeout,
+		Workers:        defaultWorkers,
+		Proto:          defaultProtocol,
+		game:           game.New(stack),
 	}
 }
 
-func (s *Server) Listen(ctx context.Context, addr string) error {
-	var wg sync.WaitGroup
+// SetLimits sets fee and jackpot limits of the game. It must be called
+// before serving starts
+func (s *Server) SetLimits(l game.Limits) {
+	s.game.Limits = l
+}
 
-	lCtx, lCancel := context.WithCancel(ctx)
+// Listen listens on the TCP network address addr and serves connections
+// until ctx is done
+func (s *Server) Listen(ctx context.Context, addr string) error {
 	lc := net.ListenConfig{}
 	l, err := lc.Listen(ctx, "tcp", addr)
 	if err != nil {
-		lCancel()
 		return err
 	}
 
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts and serves connections on l until ctx is done. If TLSConfig
+// is set, connections are secured with TLS. Serve always closes l
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	var wg sync.WaitGroup
+
+	if s.State != nil {
+		s.game.Jackpot = s.State.Jackpot()
+	}
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
+
+	lCtx, lCancel := context.WithCancel(ctx)
 	wg.Add(1)
 	go func() {
 		<-lCtx.Done()
@@ -71,7 +120,10 @@ func (s *Server) Listen(ctx context.Context, addr string) error {
 		}()
 	}
 
-	var c net.Conn
+	var (
+		c   net.Conn
+		err error
+	)
 theLoop:
 	for {
 		c, err = l.Accept()
@@ -82,51 +134,211 @@ theLoop:
 		select {
 		case connC <- c:
 		case <-ctx.Done():
+			c.Close()
 			break theLoop
 		}
 	}
 
 	close(connC)
-	wg.Wait()
 	lCancel()
+	wg.Wait()
+
+	// Accept fails once the listener is closed on shutdown
+	if ctx.Err() != nil {
+		return nil
+	}
 	return err
 }
 
-func (s *Server) play(fee uint64, bet lottery.Pair) (*lottery.Response, error) {
-	s.gameL.Lock()
-	defer s.gameL.Unlock()
+// play plays the request. Request UUID is chosen by the player, so it's used
+// as the client seed by provably fair stacks
+func (s *Server) play(req *lottery.Request, bonus bool) (*game.Outcome, error) {
+	if bonus {
+		return s.game.PlayBonus(req.Fee, req.Guess, req.UUID[:])
+	}
+	return s.game.PlayOutcome(req.Fee, req.Guess, req.UUID[:])
+}
+
+// record writes the play to the journal
+func (s *Server) record(ss *session, req *lottery.Request, o *game.Outcome, delivered bool) {
+	if s.Journal == nil {
+		return
+	}
 
-	return s.game.Play(fee, bet)
+	err := s.Journal.Write(&journal.Record{
+		Time:          time.Now().UTC(),
+		Remote:        ss.remote,
+		UUID:          req.UUID,
+		Fee:           req.Fee,
+		Guess:         req.Guess,
+		Draw:          o.Response.Draw,
+		Type:          o.Response.Type,
+		JackpotBefore: o.JackpotBefore,
+		JackpotAfter:  o.JackpotAfter,
+		Delivered:     delivered,
+	})
+	if err != nil {
+		log.Printf("error: %s: failed to write play journal: %s", ss, err)
+	}
 }
 
-func (s *Server) match(c net.Conn) (*lottery.Response, error) {
-	dec := s.Proto.GetRequestDecoder(c)
-	enc := s.Proto.GetResponseEncoder(c)
+// session holds state of a single client connection
+type session struct {
+	remote string
+	// Authenticated client identity, nil if the client is anonymous
+	identity *Identity
+
+	// Codecs may buffer input, so the same decoder must be used for
+	// every message on the connection
+	dec encoding.RequestDecoder
+	enc encoding.ResponseEncoder
+	// Number of malformed messages skipped
+	skipped int
+}
+
+func (ss *session) String() string {
+	if ss.identity == nil {
+		return ss.remote
+	}
+	return fmt.Sprintf("%s (%s)", ss.remote, ss.identity)
+}
+
+// match reads a request and plays it, bonus is set for the free round
+// following a Bonus response
+func (s *Server) match(ss *session, bonus bool) (*lottery.Response, error) {
 	req := lottery.Request{}
 
-	remote := c.RemoteAddr().String()
-	if err := dec.Decode(&req); err != nil {
-		return nil, fmt.Errorf("failed to decode initial request: %s", err)
+	for {
+		err := ss.dec.Decode(&req)
+		if err == nil {
+			break
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("failed to decode request: %s", err)
+		}
+
+		// Bad message has been skipped, the stream is still usable
+		me, skipped := err.(*encoding.MessageError)
+		if skipped {
+			err = me.Err
+		}
+
+		var se *lottery.ServerError
+		if !errors.As(err, &se) {
+			se = &lottery.ServerError{Code: lottery.CodeBadRequest, Message: err.Error()}
+		}
+		s.reject(ss, se)
+		if !skipped {
+			return nil, fmt.Errorf("failed to decode request: %s", err)
+		}
+		if ss.skipped++; ss.skipped >= maxSkipped {
+			return nil, fmt.Errorf("too many bad requests, last one: %s", err)
+		}
+		log.Printf("warning: %s: bad request skipped: %s", ss, err)
+	}
+	log.Printf("info: %s: request: %s", ss, req.String())
+
+	if err := s.authorize(ss.identity); err != nil {
+		s.reject(ss, err)
+		return nil, err
+	}
+
+	// The jackpot mustn't change once it can't be saved
+	if s.State != nil {
+		if err := s.State.Err(); err != nil {
+			s.reject(ss, &lottery.ServerError{Code: lottery.CodeUnavailable, Message: "game state can't be saved"})
+			return nil, fmt.Errorf("plays are disabled: %s", err)
+		}
 	}
-	log.Printf("info: %s: request: %s", remote, req.String())
 
-	resp, err := s.play(req.Fee, req.Guess)
+	o, err := s.play(&req, bonus)
 	if err != nil {
+		var (
+			he *game.HealthError
+			ee *game.EntropyError
+			re *game.RejectError
+		)
+		switch {
+		case errors.As(err, &re):
+			s.reject(ss, &lottery.ServerError{Code: lottery.CodeRejected, Message: re.Reason})
+		case errors.As(err, &he):
+			// Health test failures are permanent, every play fails from now on
+			log.Printf("error: plays are disabled: %s", he)
+			s.reject(ss, &lottery.ServerError{Code: lottery.CodeUnavailable, Message: he.Error()})
+		case errors.As(err, &ee):
+			s.reject(ss, &lottery.ServerError{Code: lottery.CodeInternal, Message: "entropy source failure"})
+		default:
+			s.reject(ss, err)
+		}
 		return nil, fmt.Errorf("game failed: %s", err)
 	}
-	log.Printf("info: %s: response: %s", remote, resp.String())
+	// The play is only acknowledged once its outcome is durable
+	if s.State != nil {
+		if err := s.State.Save(s.game.LoadJackpot); err != nil {
+			// Save failures are permanent, every play fails from now on
+			log.Printf("error: plays are disabled: failed to save game state: %s", err)
+			s.reject(ss, &lottery.ServerError{Code: lottery.CodeUnavailable, Message: "game state can't be saved"})
+			s.record(ss, &req, o, false)
+			return nil, fmt.Errorf("failed to save game state: %s", err)
+		}
+	}
+	resp := o.Response
+	resp.UUID = req.UUID
+	log.Printf("info: %s: response: %s", ss, resp.String())
 
-	if err := enc.Encode(resp); err != nil {
+	err = ss.enc.Encode(resp)
+	s.record(ss, &req, o, err == nil)
+	if err != nil {
 		return nil, fmt.Errorf("failed to send response: %s", err)
 	}
 
 	return resp, nil
 }
 
+// reject reports the error to the client in an Error response
+func (s *Server) reject(ss *session, err error) {
+	resp := lottery.NewErrorResponse(err)
+	log.Printf("info: %s: response: %s", ss, resp.String())
+
+	if err := ss.enc.Encode(resp); err != nil {
+		log.Printf("error: %s: failed to send error response: %s", ss, err)
+	}
+}
+
 func (s *Server) handleConn(c net.Conn) error {
 	defer c.Close()
 
-	resp, err := s.match(c)
+	ss := &session{remote: c.RemoteAddr().String()}
+
+	if tc, ok := c.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return fmt.Errorf("TLS handshake failed: %s", err)
+		}
+		ss.identity = peerIdentity(tc.ConnectionState())
+	}
+
+	ir := &idleReader{c: c, timeout: s.Timeout}
+	r := bufio.NewReader(ir)
+	proto, err := s.negotiate(ss, r)
+	if err != nil {
+		// Client can't be answered in the protocol it asked for, the
+		// error is sent in the default one
+		var se *lottery.ServerError
+		if errors.As(err, &se) {
+			ss.enc = s.wrap(s.Proto).GetResponseEncoder(c)
+			s.reject(ss, se)
+		}
+		return fmt.Errorf("failed to negotiate protocol: %s", err)
+	}
+	if _, ok := proto.(encoding.Interactive); ok {
+		ir.idle, ir.end = true, time.Now().Add(s.SessionTimeout)
+		ir.extend()
+	}
+	proto = s.wrap(proto)
+	ss.dec = proto.GetRequestDecoder(r)
+	ss.enc = proto.GetResponseEncoder(c)
+
+	resp, err := s.match(ss, false)
 	if err != nil {
 		return err
 	}
@@ -135,10 +347,68 @@ func (s *Server) handleConn(c net.Conn) error {
 		return nil
 	}
 
-	_, err = s.match(c)
+	_, err = s.match(ss, true)
 	return err
 }
 
+// wrap applies the optional decorator to proto
+func (s *Server) wrap(proto encoding.Server) encoding.Server {
+	if s.Wrap != nil {
+		return s.Wrap(proto)
+	}
+	return proto
+}
+
+// negotiate reads optional connection preamble and returns the protocol
+// implementation requested by the client. Unsupported preamble version and
+// unknown codec are reported with *lottery.ServerError
+func (s *Server) negotiate(ss *session, r *bufio.Reader) (encoding.Server, error) {
+	name, err := encoding.ReadPreamble(r)
+	if err == encoding.ErrNoPreamble {
+		return s.Proto, nil
+	}
+	var ve *encoding.UnsupportedVersionError
+	if errors.As(err, &ve) {
+		return nil, &lottery.ServerError{Code: lottery.CodeBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := encoding.Lookup(name)
+	if err != nil {
+		return nil, &lottery.ServerError{Code: lottery.CodeBadRequest, Message: err.Error()}
+	}
+	log.Printf("info: %s: protocol: %s", ss, name)
+
+	return codec.Server, nil
+}
+
+// idleReader extends the connection deadline on every read if idle is set,
+// so the connection times out when the client stops sending, or at end
+type idleReader struct {
+	c       net.Conn
+	timeout time.Duration
+	idle    bool
+	end     time.Time
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.c.Read(p)
+	if n > 0 && r.idle {
+		r.extend()
+	}
+	return n, err
+}
+
+func (r *idleReader) extend() {
+	d := time.Now().Add(r.timeout)
+	if d.After(r.end) {
+		d = r.end
+	}
+	r.c.SetDeadline(d)
+}
+
 func (s *Server) work(connC <-chan net.Conn) {
 	for c := range connC {
 		c.SetDeadline(time.Now().Add(s.Timeout))
@@ -147,6 +417,6 @@ func (s *Server) work(connC <-chan net.Conn) {
 		if err := s.handleConn(c); err != nil {
 			log.Printf("error: %s: failed to handle connection: %s", remote, err)
 		}
-		log.Printf("info: current jackpot: %d", s.game.Jackpot)
+		log.Printf("info: current jackpot: %d", s.game.LoadJackpot())
 	}
 }
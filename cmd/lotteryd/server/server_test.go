@@ -0,0 +1,774 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bpiddubnyi/lottery"
+	client "github.com/bpiddubnyi/lottery/cmd/lotteryc/game"
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/game"
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/journal"
+	"github.com/bpiddubnyi/lottery/cmd/lotteryd/state"
+	"github.com/bpiddubnyi/lottery/encoding"
+	"github.com/bpiddubnyi/lottery/encoding/binary"
+	"github.com/bpiddubnyi/lottery/encoding/jsonl"
+	"github.com/bpiddubnyi/lottery/encoding/line"
+	"github.com/bpiddubnyi/lottery/encoding/plain"
+	"github.com/bpiddubnyi/lottery/encoding/signed"
+	"github.com/google/uuid"
+)
+
+type stackMockOnes struct{}
+
+func (stackMockOnes) Pop() (lottery.Pair, error) {
+	return lottery.Pair{1, 1}, nil
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "lotteryd test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue issues a certificate for the template signed by CA
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *testCA) issueServer(t *testing.T) tls.Certificate {
+	return ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "lotteryd"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+	})
+}
+
+func (ca *testCA) issueClient(t *testing.T, cn string, uris ...string) tls.Certificate {
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = append(tmpl.URIs, u)
+	}
+	return ca.issue(t, tmpl)
+}
+
+// startServer starts s on a random local port and returns its address
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(ctx, l)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Server.Serve() error = %v", err)
+		}
+	})
+	return l.Addr().String()
+}
+
+func TestServer_TLS(t *testing.T) {
+	ca := newTestCA(t)
+	pool := ca.pool
+
+	s := New(stackMockOnes{})
+	s.Timeout = time.Second
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{ca.issueServer(t)}}
+	addr := startServer(t, s)
+
+	tests := []struct {
+		name    string
+		conf    *tls.Config
+		wantErr bool
+	}{
+		{
+			name: "trusted",
+			conf: &tls.Config{RootCAs: pool},
+		},
+		{
+			name: "server name",
+			conf: &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"},
+		},
+		{
+			name: "insecure",
+			conf: &tls.Config{InsecureSkipVerify: true},
+		},
+		{
+			name:    "untrusted",
+			conf:    &tls.Config{RootCAs: x509.NewCertPool()},
+			wantErr: true,
+		},
+		{
+			name:    "wrong server name",
+			conf:    &tls.Config{RootCAs: pool, ServerName: "example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "plaintext",
+			conf:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := client.NewClient(addr)
+			c.TLSConfig = tt.conf
+
+			resp, err := c.Play(42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.Play() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && resp.Type == lottery.Error {
+				t.Errorf("Client.Play() = %v", resp)
+			}
+		})
+	}
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+
+	s := New(stackMockOnes{})
+	s.Timeout = time.Second
+	s.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{ca.issueServer(t)},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	s.Allow = []string{"alice", "spiffe://example.org/player/bob"}
+	addr := startServer(t, s)
+
+	tests := []struct {
+		name     string
+		certs    []tls.Certificate
+		wantErr  bool
+		wantCode lottery.ErrorCode
+	}{
+		{
+			name:  "allowed CN",
+			certs: []tls.Certificate{ca.issueClient(t, "alice")},
+		},
+		{
+			name:  "allowed URI",
+			certs: []tls.Certificate{ca.issueClient(t, "", "spiffe://example.org/player/bob")},
+		},
+		{
+			name:     "not allowed",
+			certs:    []tls.Certificate{ca.issueClient(t, "carol", "spiffe://example.org/player/carol")},
+			wantErr:  true,
+			wantCode: lottery.CodeUnauthorized,
+		},
+		{
+			name:    "untrusted CA",
+			certs:   []tls.Certificate{otherCA.issueClient(t, "alice")},
+			wantErr: true,
+		},
+		{
+			name:    "no certificate",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := client.NewClient(addr)
+			c.TLSConfig = &tls.Config{RootCAs: ca.pool, Certificates: tt.certs}
+
+			_, err := c.Play(42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Client.Play() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantCode != lottery.CodeUnknown {
+				if se, ok := err.(*lottery.ServerError); !ok || se.Code != tt.wantCode {
+					t.Errorf("Client.Play() error = %v, want code %d", err, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_Seeded(t *testing.T) {
+	// "seed" draws 16:36, 224:62, 241:103
+	stack, err := game.NewSeededStack([]byte("seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(stack)
+	s.Timeout = time.Second
+	addr := startServer(t, s)
+
+	sessions := [][]struct {
+		req  lottery.Request
+		want lottery.Response
+	}{
+		{
+			{
+				req:  lottery.Request{Fee: 42, Guess: lottery.Pair{16, 36}},
+				want: lottery.Response{Type: lottery.Bonus},
+			},
+			{
+				req:  lottery.Request{Fee: 0, Guess: lottery.Pair{0, 0}},
+				want: lottery.Response{Type: lottery.NoWin},
+			},
+		},
+		{
+			{
+				req:  lottery.Request{Fee: 10, Guess: lottery.Pair{241, 103}},
+				want: lottery.Response{Type: lottery.Win, Jackpot: 52},
+			},
+		},
+	}
+	for i, msgs := range sessions {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc := plain.NewRequestEncoder(c)
+		dec := plain.NewResponseDecoder(c)
+
+		for j, m := range msgs {
+			if err := enc.Encode(&m.req); err != nil {
+				t.Fatalf("session %d #%d: Encode() error = %v", i, j, err)
+			}
+			var got lottery.Response
+			if err := dec.Decode(&got); err != nil {
+				t.Fatalf("session %d #%d: Decode() error = %v", i, j, err)
+			}
+			if got != m.want {
+				t.Errorf("session %d #%d: response = %v, want %v", i, j, got, m.want)
+			}
+		}
+		c.Close()
+	}
+}
+
+// stackMockFailing fails every Pop with err
+type stackMockFailing struct {
+	err error
+}
+
+func (s stackMockFailing) Pop() (lottery.Pair, error) {
+	return lottery.Pair{}, s.err
+}
+
+func TestServer_StackFailure(t *testing.T) {
+	healthErr := &game.HealthError{Test: "repetition count test", Reason: "stuck"}
+
+	tests := []struct {
+		name string
+		err  error
+		want lottery.ServerError
+	}{
+		{
+			name: "entropy",
+			err:  &game.EntropyError{Err: io.ErrUnexpectedEOF},
+			want: lottery.ServerError{Code: lottery.CodeInternal, Message: "entropy source failure"},
+		},
+		{
+			name: "health",
+			err:  &game.EntropyError{Err: healthErr},
+			want: lottery.ServerError{Code: lottery.CodeUnavailable, Message: healthErr.Error()},
+		},
+		{
+			name: "other",
+			err:  errors.New("secret details"),
+			want: lottery.ServerError{Code: lottery.CodeInternal},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(stackMockFailing{err: tt.err})
+			s.Timeout = time.Second
+			addr := startServer(t, s)
+
+			_, err := client.NewClient(addr).Play(42)
+			se, ok := err.(*lottery.ServerError)
+			if !ok {
+				t.Fatalf("Client.Play() error = %v, want *lottery.ServerError", err)
+			}
+			if *se != tt.want {
+				t.Errorf("Client.Play() error = %v, want %v", se, &tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_Limits(t *testing.T) {
+	tests := []struct {
+		name    string
+		fee     uint64
+		wantErr *lottery.ServerError
+	}{
+		{
+			name: "accepted",
+			fee:  100,
+		},
+		{
+			name:    "below min",
+			fee:     9,
+			wantErr: &lottery.ServerError{Code: lottery.CodeRejected, Message: "fee 9 is below minimum of 10"},
+		},
+		{
+			name:    "above max",
+			fee:     math.MaxUint64,
+			wantErr: &lottery.ServerError{Code: lottery.CodeRejected, Message: "fee 18446744073709551615 exceeds maximum of 100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(stackMockOnes{})
+			s.Timeout = time.Second
+			s.SetLimits(game.Limits{MinFee: 10, MaxFee: 100})
+			addr := startServer(t, s)
+
+			_, err := client.NewClient(addr).Play(tt.fee)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Client.Play() error = %v", err)
+				}
+				return
+			}
+			se, ok := err.(*lottery.ServerError)
+			if !ok {
+				t.Fatalf("Client.Play() error = %v, want *lottery.ServerError", err)
+			}
+			if *se != *tt.wantErr {
+				t.Errorf("Client.Play() error = %v, want %v", se, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServer_BonusMinFee(t *testing.T) {
+	s := New(stackMockOnes{})
+	s.Timeout = time.Second
+	s.SetLimits(game.Limits{MinFee: 10})
+	addr := startServer(t, s)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	enc := plain.NewRequestEncoder(c)
+	dec := plain.NewResponseDecoder(c)
+
+	// Bonus round is free, the minimum fee doesn't apply to it
+	msgs := []struct {
+		req  lottery.Request
+		want lottery.Response
+	}{
+		{
+			req:  lottery.Request{Fee: 10, Guess: lottery.Pair{1, 1}},
+			want: lottery.Response{Type: lottery.Bonus},
+		},
+		{
+			req:  lottery.Request{Fee: 0, Guess: lottery.Pair{0, 0}},
+			want: lottery.Response{Type: lottery.NoWin},
+		},
+	}
+	for i, m := range msgs {
+		if err := enc.Encode(&m.req); err != nil {
+			t.Fatalf("#%d: Encode() error = %v", i, err)
+		}
+		var got lottery.Response
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("#%d: Decode() error = %v", i, err)
+		}
+		if got != m.want {
+			t.Errorf("#%d: response = %v, want %v", i, got, m.want)
+		}
+	}
+}
+
+func TestServer_State(t *testing.T) {
+	dir, err := os.MkdirTemp("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	st, err := state.Open(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Save(func() uint64 { return 100 }); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(stackMockOnes{})
+	s.Timeout = time.Second
+	s.State = st
+	addr := startServer(t, s)
+
+	resp, err := client.NewClient(addr).Play(42)
+	if err != nil {
+		t.Fatalf("Client.Play() error = %v", err)
+	}
+	// Random guess hits the jackpot rarely
+	want := uint64(142)
+	if resp.Type == lottery.Win {
+		want = 0
+	}
+	if got := st.Jackpot(); got != want {
+		t.Errorf("saved jackpot = %d, want %d", got, want)
+	}
+}
+
+func TestServer_Journal(t *testing.T) {
+	dir, err := os.MkdirTemp("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	j, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	s := New(stackMockOnes{})
+	s.Timeout = time.Second
+	s.Journal = j
+	addr := startServer(t, s)
+
+	resp, err := client.NewClient(addr).Play(42)
+	if err != nil {
+		t.Fatalf("Client.Play() error = %v", err)
+	}
+	if resp.Type != lottery.NoWin {
+		t.Skipf("random guess has won: %s", resp)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e journal.Entry
+	if err := json.Unmarshal(data, &e); err != nil || e.Play == nil {
+		t.Fatalf("invalid journal %q: %v", data, err)
+	}
+	got := *e.Play
+
+	want := journal.Record{
+		Time:          got.Time,
+		Remote:        got.Remote,
+		UUID:          got.UUID,
+		Fee:           42,
+		Guess:         got.Guess,
+		Draw:          lottery.Pair{1, 1},
+		Type:          lottery.NoWin,
+		JackpotBefore: 0,
+		JackpotAfter:  42,
+		Delivered:     true,
+	}
+	if got != want {
+		t.Errorf("journal record = %+v, want %+v", got, want)
+	}
+	// Base protocols don't return the UUID, so the client's one is unknown
+	if got.Time.IsZero() || got.Remote == "" || got.UUID == (uuid.UUID{}) {
+		t.Errorf("journal record misses time, remote address or UUID: %+v", got)
+	}
+}
+
+func TestServer_StateFailure(t *testing.T) {
+	dir, err := os.MkdirTemp("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	st, err := state.Open(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Save(func() uint64 { return 100 }); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(stackMockOnes{})
+	s.Timeout = time.Second
+	s.State = st
+	addr := startServer(t, s)
+
+	// Closed store can't save plays anymore
+	st.Close()
+	for i := 0; i < 2; i++ {
+		_, err = client.NewClient(addr).Play(42)
+		want := lottery.ServerError{Code: lottery.CodeUnavailable, Message: "game state can't be saved"}
+		if se, ok := err.(*lottery.ServerError); !ok || *se != want {
+			t.Errorf("Client.Play() error = %v, want %v", err, &want)
+		}
+	}
+	if got := s.game.LoadJackpot(); got != 100 {
+		t.Errorf("jackpot = %d, want unchanged 100", got)
+	}
+}
+
+func TestServer_Fair(t *testing.T) {
+	stack, err := game.NewFairStack(game.DefaultRotate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stack.Close()
+	var commit [lottery.CommitLen]byte
+	copy(commit[:], stack.Commit())
+
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	s := New(game.NewLocked(stack))
+	s.Timeout = time.Second
+	s.Wrap = func(proto encoding.Server) encoding.Server { return signed.NewServer(proto, key) }
+	addr := startServer(t, s)
+
+	// Every response carries the commitment and nonce of its draw
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plain.NewRequestEncoder(c).Encode(&lottery.Request{UUID: uuid.New(), Fee: 1}); err != nil {
+			t.Fatal(err)
+		}
+		var got lottery.Response
+		err = signed.NewResponseDecoder(c, plain.Client{}, key.Public().(ed25519.PublicKey)).Decode(&got)
+		c.Close()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if got.Commit != commit || got.Nonce != nonce {
+			t.Errorf("response commit %x nonce %d, want %x %d", got.Commit, got.Nonce, commit, nonce)
+		}
+	}
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	s := New(stackMockOnes{})
+	s.Proto = line.Server{}
+	s.Timeout = 200 * time.Millisecond
+	addr := startServer(t, s)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Typing takes longer than the timeout, but pauses are shorter
+	for _, part := range []string{"PLAY 550e8400", "-e29b-41d4-a716", "-446655440000 ", "10 ", "2:2\r\n"} {
+		time.Sleep(100 * time.Millisecond)
+		if _, err := io.WriteString(c, part); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got lottery.Response
+	if err := line.NewResponseDecoder(c).Decode(&got); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got.Type != lottery.NoWin {
+		t.Errorf("response = %v, want %v", got, lottery.NoWin)
+	}
+}
+
+func TestServer_SkipLimit(t *testing.T) {
+	s := New(stackMockOnes{})
+	s.Proto = line.Server{}
+	s.Timeout = time.Second
+	addr := startServer(t, s)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	dec := line.NewResponseDecoder(c)
+	for i := 0; i < maxSkipped; i++ {
+		if _, err := io.WriteString(c, "HELLO\r\n"); err != nil {
+			t.Fatal(err)
+		}
+		var got lottery.Response
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("#%d: Decode() error = %v", i, err)
+		}
+		if got.Type != lottery.Error || got.Code != lottery.CodeBadRequest {
+			t.Errorf("#%d: response = %v, want bad request", i, got)
+		}
+	}
+
+	// Connection is closed after too many bad requests
+	var got lottery.Response
+	if err := dec.Decode(&got); err != io.EOF {
+		t.Errorf("Decode() error = %v, want EOF", err)
+	}
+}
+
+func TestServer_SessionTimeout(t *testing.T) {
+	s := New(stackMockOnes{})
+	s.Proto = line.Server{}
+	s.Timeout = 200 * time.Millisecond
+	s.SessionTimeout = 400 * time.Millisecond
+	addr := startServer(t, s)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Client keeps typing, but never finishes the line
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(50 * time.Millisecond):
+				if _, err := io.WriteString(c, "P"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	start := time.Now()
+	c.SetReadDeadline(start.Add(5 * time.Second))
+	// Unread input may make the close a reset
+	if _, err := io.ReadAll(c); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatalf("connection isn't closed: %v", err)
+		}
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("connection closed after %v, want about %v", d, s.SessionTimeout)
+	}
+}
+
+func TestServer_Negotiate(t *testing.T) {
+	s := New(stackMockOnes{})
+	s.Timeout = time.Second
+	addr := startServer(t, s)
+
+	// One listener serves clients with and without preamble
+	clients := []struct {
+		name  string
+		proto encoding.Client
+	}{
+		{name: "", proto: plain.Client{}},
+		{name: "binary", proto: binary.Client{}},
+		{name: "jsonl", proto: jsonl.Client{}},
+	}
+	for _, cc := range clients {
+		c := client.NewClient(addr)
+		c.Proto, c.ProtoName = cc.proto, cc.name
+		if _, err := c.Play(42); err != nil {
+			t.Errorf("%q: Client.Play() error = %v", cc.name, err)
+		}
+	}
+
+	// Bad preambles are answered in the default protocol
+	for _, preamble := range []string{"LTRY\x02\x05plain", "LTRY\x01\x03foo"} {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(c, preamble); err != nil {
+			t.Fatal(err)
+		}
+		var got lottery.Response
+		err = plain.NewResponseDecoder(c).Decode(&got)
+		c.Close()
+		if err != nil {
+			t.Fatalf("%q: Decode() error = %v", preamble, err)
+		}
+		if got.Type != lottery.Error || got.Code != lottery.CodeBadRequest {
+			t.Errorf("%q: response = %v, want bad request", preamble, got)
+		}
+	}
+}
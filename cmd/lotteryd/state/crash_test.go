@@ -0,0 +1,150 @@
+package state
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestCrashHelper isn't a real test: it's run by TestStore_Crash in a child
+// process, which saves growing jackpots, reports each acknowledged one on
+// stdout and kills itself at the n-th hit of the crash point
+func TestCrashHelper(t *testing.T) {
+	dir := os.Getenv("STATE_CRASH_DIR")
+	if dir == "" {
+		t.Skip("crash helper process only")
+	}
+	point := os.Getenv("STATE_CRASH_POINT")
+	n, _ := strconv.Atoi(os.Getenv("STATE_CRASH_N"))
+
+	s, err := Open(dir, false)
+	if err != nil {
+		fmt.Printf("error %s\n", err)
+		os.Exit(1)
+	}
+	s.SnapshotEvery = 7
+	s.crash = func(p string) {
+		if p != point {
+			return
+		}
+		if n--; n == 0 {
+			proc, _ := os.FindProcess(os.Getpid())
+			proc.Kill()
+			select {}
+		}
+	}
+
+	for j := s.Jackpot() + 1; ; j++ {
+		if err := s.Save(func() uint64 { return j }); err != nil {
+			fmt.Printf("error %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("saved %d\n", j)
+	}
+}
+
+func TestStore_Crash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping crash tests in short mode")
+	}
+
+	tests := []struct {
+		point string
+		// Hits of the crash point before the kill, for every run
+		hits []int
+	}{
+		// Killed by the parent after the given number of saves
+		{point: "", hits: []int{1, 5, 50}},
+		{point: "wal-write", hits: []int{1, 6, 7, 30}},
+		{point: "wal-sync", hits: []int{1, 6, 7, 30}},
+		{point: "snapshot-write", hits: []int{1, 2, 3, 5}},
+		{point: "snapshot-rename", hits: []int{1, 2, 3, 5}},
+	}
+	for _, tt := range tests {
+		name := tt.point
+		if name == "" {
+			name = "kill"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "state")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			for _, n := range tt.hits {
+				acked, printed := runCrashHelper(t, dir, tt.point, n)
+
+				s, err := Open(dir, false)
+				if err != nil {
+					t.Fatalf("Open() after crash at %s #%d error = %v", tt.point, n, err)
+				}
+				// The child keeps saving until the kill arrives, and the
+				// save in progress may or may not survive the crash
+				if got := s.Jackpot(); got < acked || got > printed+1 {
+					t.Errorf("jackpot after crash at %s #%d = %d, acknowledged %d, printed %d",
+						tt.point, n, got, acked, printed)
+				}
+				s.Close()
+			}
+		})
+	}
+}
+
+// runCrashHelper runs the helper process until it's killed. It returns the
+// jackpot acknowledged when the kill was decided and the last one printed
+// before the process died
+func runCrashHelper(t *testing.T, dir, point string, n int) (acked, printed uint64) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashHelper$")
+	cmd.Env = append(os.Environ(),
+		"STATE_CRASH_DIR="+dir,
+		"STATE_CRASH_POINT="+point,
+		fmt.Sprintf("STATE_CRASH_N=%d", n))
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		saves  int
+		killed bool
+	)
+	// Output is read until the process dies, it may be blocked on
+	// writing it
+	sc := bufio.NewScanner(out)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "error ") {
+			t.Errorf("helper process: %s", line)
+			continue
+		}
+
+		j, err := strconv.ParseUint(strings.TrimPrefix(line, "saved "), 10, 64)
+		if err != nil {
+			continue
+		}
+		printed = j
+		if killed {
+			continue
+		}
+		acked = j
+		if saves++; point == "" && saves == n {
+			cmd.Process.Kill()
+			killed = true
+		}
+	}
+
+	if err := cmd.Wait(); err == nil {
+		t.Errorf("helper process exited normally, want it killed")
+	}
+	return acked, printed
+}
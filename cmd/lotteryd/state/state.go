@@ -0,0 +1,347 @@
+// Package state keeps the game jackpot across lotteryd restarts. Every change
+// of the jackpot is appended to a write-ahead log and fsync'd before it's
+// acknowledged. The log is compacted into a snapshot periodically, on startup
+// and on close.
+//
+// Both files are made of records holding a sequence number, the jackpot and
+// a CRC-32C checksum. A crash may leave a torn record at the end of the log,
+// it's discarded on recovery. Any other damage makes the state corrupt.
+package state
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// DefaultSnapshotEvery is the default number of log records between
+	// snapshots
+	DefaultSnapshotEvery = 1000
+
+	snapshotName = "snapshot"
+	walName      = "wal"
+
+	// Sequence number, jackpot and checksum
+	recordSize = 8 + 8 + 4
+)
+
+var (
+	errClosed = errors.New("state store is closed")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// CorruptError is returned by Open if the state files are damaged
+type CorruptError struct {
+	Path   string
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("state file %s is corrupt: %s", e.Path, e.Reason)
+}
+
+type record struct {
+	seq     uint64
+	jackpot uint64
+}
+
+func (r record) marshal() []byte {
+	b := make([]byte, recordSize)
+	binary.BigEndian.PutUint64(b, r.seq)
+	binary.BigEndian.PutUint64(b[8:], r.jackpot)
+	binary.BigEndian.PutUint32(b[16:], crc32.Checksum(b[:16], crcTable))
+	return b
+}
+
+func unmarshal(b []byte) (record, bool) {
+	if crc32.Checksum(b[:16], crcTable) != binary.BigEndian.Uint32(b[16:]) {
+		return record{}, false
+	}
+	return record{
+		seq:     binary.BigEndian.Uint64(b),
+		jackpot: binary.BigEndian.Uint64(b[8:]),
+	}, true
+}
+
+// Store persists the jackpot in a directory. Store is safe for concurrent use
+type Store struct {
+	// Number of log records between snapshots
+	SnapshotEvery int
+
+	dir string
+
+	mu         sync.Mutex
+	wal        *os.File
+	last       record
+	walRecords int
+	// Write failure, the log may be damaged after it, so no more
+	// records are written
+	err error
+
+	// Called at points where a crash matters, for tests
+	crash func(point string)
+}
+
+// Open recovers the state kept in dir, creating the directory if needed.
+// Corrupt state fails with *CorruptError, unless force is set: then the state
+// is recovered up to the damage and the rest is discarded
+func Open(dir string, force bool) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Store{SnapshotEvery: DefaultSnapshotEvery, dir: dir}
+	last, err := s.recover()
+	var ce *CorruptError
+	if errors.As(err, &ce) && force {
+		log.Printf("warning: state: %s, recovered jackpot %d and discarded the rest", ce, last.jackpot)
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.last = last
+
+	// Start from a clean snapshot and an empty log
+	if err := writeSnapshot(dir, last, s.hook); err != nil {
+		return nil, err
+	}
+	s.wal, err = os.OpenFile(filepath.Join(dir, walName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncFile(s.wal, dir); err != nil {
+		s.wal.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// recover reads the snapshot and applies the log to it. On corruption it
+// returns the state recovered so far along with *CorruptError
+func (s *Store) recover() (record, error) {
+	var (
+		last record
+		// Whether last comes from a valid snapshot. Otherwise the log
+		// is trusted to start at any sequence number
+		based = true
+		cerr  error
+	)
+
+	path := filepath.Join(s.dir, snapshotName)
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return last, err
+	case len(data) != recordSize:
+		cerr = &CorruptError{Path: path, Reason: fmt.Sprintf("size is %d, want %d", len(data), recordSize)}
+		based = false
+	default:
+		var ok bool
+		if last, ok = unmarshal(data); !ok {
+			cerr = &CorruptError{Path: path, Reason: "checksum mismatch"}
+			based = false
+		}
+	}
+
+	path = filepath.Join(s.dir, walName)
+	data, err = os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return last, cerr
+	}
+	if err != nil {
+		return last, err
+	}
+
+	applied := false
+	for off := 0; off+recordSize <= len(data); off += recordSize {
+		rec, ok := unmarshal(data[off : off+recordSize])
+		if !ok {
+			// Only the last record may be torn by a crash
+			if off+recordSize < len(data) && cerr == nil {
+				cerr = &CorruptError{Path: path, Reason: fmt.Sprintf("checksum mismatch at offset %d", off)}
+			}
+			break
+		}
+
+		switch {
+		case !based && !applied:
+		case rec.seq <= last.seq && !applied:
+			// Records left over from a crash before the log was
+			// truncated, they are already in the snapshot
+			continue
+		case rec.seq != last.seq+1:
+			if cerr == nil {
+				cerr = &CorruptError{Path: path,
+					Reason: fmt.Sprintf("record %d follows record %d at offset %d", rec.seq, last.seq, off)}
+			}
+			return last, cerr
+		}
+		last, applied = rec, true
+	}
+	return last, cerr
+}
+
+// Jackpot returns the last recorded jackpot
+func (s *Store) Jackpot() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last.jackpot
+}
+
+// Err returns the error Save fails with once the store is closed or has
+// failed to write, nil otherwise. Write failures are permanent, the log may
+// end with a torn record after them
+func (s *Store) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if s.wal == nil {
+		return errClosed
+	}
+	return nil
+}
+
+// Save durably records the jackpot returned by jackpot. It's called under the
+// store lock, so concurrent saves record the jackpot in the order it changes,
+// and saves waiting for the lock share the fsync of the latest value
+func (s *Store) Save(jackpot func() uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if s.wal == nil {
+		return errClosed
+	}
+
+	rec := record{seq: s.last.seq + 1, jackpot: jackpot()}
+	if rec.jackpot == s.last.jackpot {
+		return nil
+	}
+
+	if _, err := s.wal.Write(rec.marshal()); err != nil {
+		s.err = fmt.Errorf("failed to write log: %s", err)
+		return s.err
+	}
+	s.hook("wal-write")
+	if err := s.wal.Sync(); err != nil {
+		s.err = fmt.Errorf("failed to sync log: %s", err)
+		return s.err
+	}
+	s.hook("wal-sync")
+	s.last = rec
+
+	s.walRecords++
+	if s.walRecords >= s.SnapshotEvery {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact writes the snapshot and empties the log
+func (s *Store) compact() error {
+	if err := writeSnapshot(s.dir, s.last, s.hook); err != nil {
+		s.err = fmt.Errorf("failed to write snapshot: %s", err)
+		return s.err
+	}
+	if err := s.wal.Truncate(0); err != nil {
+		s.err = fmt.Errorf("failed to truncate log: %s", err)
+		return s.err
+	}
+	if err := s.wal.Sync(); err != nil {
+		s.err = fmt.Errorf("failed to sync log: %s", err)
+		return s.err
+	}
+	s.walRecords = 0
+	return nil
+}
+
+// Close writes the final snapshot and closes the log
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return errClosed
+	}
+
+	err := s.err
+	if err == nil {
+		err = s.compact()
+	}
+	if cerr := s.wal.Close(); err == nil {
+		err = cerr
+	}
+	s.wal = nil
+	return err
+}
+
+func (s *Store) hook(point string) {
+	if s.crash != nil {
+		s.crash(point)
+	}
+}
+
+// writeSnapshot atomically replaces the snapshot in dir with rec
+func writeSnapshot(dir string, rec record, hook func(string)) error {
+	path := filepath.Join(dir, snapshotName)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(rec.marshal()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	hook("snapshot-write")
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+	hook("snapshot-rename")
+	return nil
+}
+
+// syncFile syncs f and the directory entry of f in dir
+func syncFile(f *os.File, dir string) error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,248 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func records(recs ...record) []byte {
+	var b []byte
+	for _, r := range recs {
+		b = append(b, r.marshal()...)
+	}
+	return b
+}
+
+func corrupted(b []byte, off int) []byte {
+	b = append([]byte(nil), b...)
+	b[off] ^= 0xff
+	return b
+}
+
+func TestOpen_Recover(t *testing.T) {
+	wal := records(record{3, 30}, record{4, 40}, record{5, 50})
+
+	tests := []struct {
+		name        string
+		snapshot    []byte
+		wal         []byte
+		want        uint64
+		wantCorrupt bool
+		// Jackpot recovered with force, if corrupt
+		wantForced uint64
+	}{
+		{
+			name: "empty",
+			want: 0,
+		},
+		{
+			name:     "snapshot",
+			snapshot: records(record{2, 20}),
+			want:     20,
+		},
+		{
+			name:     "snapshot and log",
+			snapshot: records(record{2, 20}),
+			wal:      wal,
+			want:     50,
+		},
+		{
+			name: "log only",
+			wal:  records(record{1, 10}, record{2, 20}),
+			want: 20,
+		},
+		{
+			name:     "log not truncated after snapshot",
+			snapshot: records(record{5, 50}),
+			wal:      wal,
+			want:     50,
+		},
+		{
+			name:     "log partially in snapshot",
+			snapshot: records(record{4, 40}),
+			wal:      wal,
+			want:     50,
+		},
+		{
+			name:     "torn record",
+			snapshot: records(record{2, 20}),
+			wal:      wal[:len(wal)-5],
+			want:     40,
+		},
+		{
+			name:     "torn last record checksum",
+			snapshot: records(record{2, 20}),
+			wal:      corrupted(wal, 2*recordSize+10),
+			want:     40,
+		},
+		{
+			name:        "damaged record in the middle",
+			snapshot:    records(record{2, 20}),
+			wal:         corrupted(wal, recordSize+10),
+			wantCorrupt: true,
+			wantForced:  30,
+		},
+		{
+			name:        "sequence gap",
+			snapshot:    records(record{1, 10}),
+			wal:         wal,
+			wantCorrupt: true,
+			wantForced:  10,
+		},
+		{
+			name:        "snapshot checksum",
+			snapshot:    corrupted(records(record{2, 20}), 12),
+			wantCorrupt: true,
+			wantForced:  0,
+		},
+		{
+			name:        "snapshot size",
+			snapshot:    records(record{2, 20})[:recordSize-1],
+			wal:         wal,
+			wantCorrupt: true,
+			wantForced:  50,
+		},
+	}
+	for _, tt := range tests {
+		for _, force := range []bool{false, true} {
+			dir, err := os.MkdirTemp("", "state")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			if tt.snapshot != nil {
+				if err := os.WriteFile(filepath.Join(dir, snapshotName), tt.snapshot, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.wal != nil {
+				if err := os.WriteFile(filepath.Join(dir, walName), tt.wal, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s, err := Open(dir, force)
+			var ce *CorruptError
+			if isCorrupt := errors.As(err, &ce); isCorrupt != (tt.wantCorrupt && !force) {
+				t.Errorf("%s: Open(force=%v) error = %v, wantCorrupt %v", tt.name, force, err, tt.wantCorrupt)
+				continue
+			}
+			if err != nil {
+				if ce == nil {
+					t.Errorf("%s: Open(force=%v) error = %v", tt.name, force, err)
+				}
+				continue
+			}
+
+			want := tt.want
+			if tt.wantCorrupt {
+				want = tt.wantForced
+			}
+			if got := s.Jackpot(); got != want {
+				t.Errorf("%s: Open(force=%v) jackpot = %d, want %d", tt.name, force, got, want)
+			}
+			s.Close()
+
+			// Recovered state is rewritten, so it opens cleanly
+			s, err = Open(dir, false)
+			if err != nil {
+				t.Errorf("%s: reopen error = %v", tt.name, err)
+				continue
+			}
+			if got := s.Jackpot(); got != want {
+				t.Errorf("%s: reopen jackpot = %d, want %d", tt.name, got, want)
+			}
+			s.Close()
+		}
+	}
+}
+
+func TestStore_Save(t *testing.T) {
+	dir, err := os.MkdirTemp("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SnapshotEvery = 3
+
+	jackpots := []uint64{10, 10, 20, 0, 42, 50}
+	for _, j := range jackpots {
+		if err := s.Save(func() uint64 { return j }); err != nil {
+			t.Fatalf("Store.Save() error = %v", err)
+		}
+	}
+
+	// Unchanged jackpot isn't recorded, so 5 records are written: a
+	// snapshot of the 3rd one and 2 records in the log
+	fi, err := os.Stat(filepath.Join(dir, walName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 2*recordSize {
+		t.Errorf("log size = %d, want %d", fi.Size(), 2*recordSize)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, snapshotName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := unmarshal(data); rec != (record{3, 0}) {
+		t.Errorf("snapshot = %+v, want %+v", rec, record{3, 0})
+	}
+
+	// Simulate a crash: the log isn't compacted on close
+	s.wal.Close()
+
+	s, err = Open(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Jackpot(); got != 50 {
+		t.Errorf("Store.Jackpot() = %d, want 50", got)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Store.Close() error = %v", err)
+	}
+	if err := s.Save(func() uint64 { return 1 }); err != errClosed {
+		t.Errorf("Store.Save() after close error = %v, want %v", err, errClosed)
+	}
+}
+
+func TestStore_Err(t *testing.T) {
+	dir, err := os.MkdirTemp("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("Store.Err() = %v, want nil", err)
+	}
+
+	// Write failure is permanent
+	s.wal.Close()
+	if err := s.Save(func() uint64 { return 1 }); err == nil {
+		t.Fatalf("Store.Save() error = nil, want write failure")
+	}
+	werr := s.Err()
+	if werr == nil {
+		t.Fatalf("Store.Err() = nil after write failure")
+	}
+	if err := s.Save(func() uint64 { return 2 }); err != werr {
+		t.Errorf("Store.Save() error = %v, want %v", err, werr)
+	}
+	if got := s.Jackpot(); got != 0 {
+		t.Errorf("Store.Jackpot() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,290 @@
+// Package auth implements a decorator which authenticates requests of the
+// wrapped codec with HMAC-SHA256 using per-player shared secrets. Every
+// request is followed by a trailer:
+//
+//	keyIDLen  uint8     length of key ID
+//	keyID     []byte    player key ID
+//	timestamp int64     big endian unix time in seconds
+//	mac       [32]byte  HMAC-SHA256 of key ID, UUID, fee, guess and timestamp
+//
+// Responses are passed through unchanged.
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding"
+)
+
+const (
+	// DefaultMaxSkew is the default maximum difference between request
+	// timestamp and server clock
+	DefaultMaxSkew = 30 * time.Second
+
+	maxKeyIDLen  = 255
+	minSecretLen = 16
+)
+
+type mac [sha256.Size]byte
+
+// sum computes request MAC
+func sum(secret []byte, keyID string, r *lottery.Request, ts int64) mac {
+	var (
+		res mac
+		buf [8]byte
+	)
+
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte{byte(len(keyID))})
+	h.Write([]byte(keyID))
+	h.Write(r.UUID[:])
+	binary.BigEndian.PutUint64(buf[:], r.Fee)
+	h.Write(buf[:])
+	h.Write(r.Guess[:])
+	binary.BigEndian.PutUint64(buf[:], uint64(ts))
+	h.Write(buf[:])
+
+	copy(res[:], h.Sum(nil))
+	return res
+}
+
+func unauthorized(msg string) error {
+	return &lottery.ServerError{Code: lottery.CodeUnauthorized, Message: msg}
+}
+
+// Signer signs requests on behalf of a player
+type Signer struct {
+	KeyID  string
+	Secret []byte
+	// Clock, time.Now is used if nil
+	Now func() time.Time
+}
+
+// NewSigner creates signer for the player key ID. Use KeyStore to load
+// the secret from a key file
+func NewSigner(keyID string, secret []byte) (*Signer, error) {
+	if len(keyID) == 0 || len(keyID) > maxKeyIDLen {
+		return nil, errors.New("invalid key id")
+	}
+	if len(secret) < minSecretLen {
+		return nil, errors.New("secret is too short")
+	}
+	return &Signer{KeyID: keyID, Secret: secret}, nil
+}
+
+func (s *Signer) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+// appendTrailer appends signed request trailer to dst
+func (s *Signer) appendTrailer(dst []byte, r *lottery.Request) []byte {
+	var buf [8]byte
+
+	ts := s.now().Unix()
+	m := sum(s.Secret, s.KeyID, r, ts)
+
+	dst = append(dst, byte(len(s.KeyID)))
+	dst = append(dst, s.KeyID...)
+	binary.BigEndian.PutUint64(buf[:], uint64(ts))
+	dst = append(dst, buf[:]...)
+	return append(dst, m[:]...)
+}
+
+// Verifier checks request signatures against a key store. Requests are only
+// accepted within MaxSkew of the server clock and each signature is accepted
+// once. Verifier is safe for concurrent use
+type Verifier struct {
+	Keys    *KeyStore
+	MaxSkew time.Duration
+	// Clock, time.Now is used if nil
+	Now func() time.Time
+
+	seenL     sync.Mutex
+	seen      map[mac]int64
+	lastPrune int64
+}
+
+func NewVerifier(keys *KeyStore) *Verifier {
+	return &Verifier{
+		Keys:    keys,
+		MaxSkew: DefaultMaxSkew,
+		seen:    make(map[mac]int64),
+	}
+}
+
+func (v *Verifier) now() time.Time {
+	if v.Now == nil {
+		return time.Now()
+	}
+	return v.Now()
+}
+
+func (v *Verifier) verify(r *lottery.Request, keyID string, ts int64, m mac) error {
+	secret, ok := v.Keys.Key(keyID)
+	if !ok {
+		return unauthorized("unknown key id")
+	}
+
+	expected := sum(secret, keyID, r, ts)
+	if !hmac.Equal(expected[:], m[:]) {
+		return unauthorized("invalid signature")
+	}
+
+	now := v.now().Unix()
+	skew := int64(v.MaxSkew / time.Second)
+	if ts < now-skew || ts > now+skew {
+		return unauthorized("request timestamp is out of allowed window")
+	}
+
+	if !v.remember(m, ts, now) {
+		return unauthorized("replayed request")
+	}
+	return nil
+}
+
+// remember records the signature and reports whether it hasn't been seen yet.
+// Signatures with timestamps out of the allowed window are forgotten, since
+// they can't be accepted anyway
+func (v *Verifier) remember(m mac, ts, now int64) bool {
+	v.seenL.Lock()
+	defer v.seenL.Unlock()
+
+	skew := int64(v.MaxSkew / time.Second)
+	if now-v.lastPrune > skew {
+		for k, t := range v.seen {
+			if t < now-skew {
+				delete(v.seen, k)
+			}
+		}
+		v.lastPrune = now
+	}
+
+	if _, ok := v.seen[m]; ok {
+		return false
+	}
+	v.seen[m] = ts
+	return true
+}
+
+type RequestEncoder struct {
+	w      io.Writer
+	buf    bytes.Buffer
+	enc    encoding.RequestEncoder
+	signer *Signer
+}
+
+func NewRequestEncoder(w io.Writer, proto encoding.Client, signer *Signer) *RequestEncoder {
+	enc := &RequestEncoder{w: w, signer: signer}
+	enc.enc = proto.GetRequestEncoder(&enc.buf)
+	return enc
+}
+
+func (enc *RequestEncoder) Encode(r *lottery.Request) error {
+	defer enc.buf.Reset()
+
+	if err := enc.enc.Encode(r); err != nil {
+		return err
+	}
+
+	data := enc.signer.appendTrailer(enc.buf.Bytes(), r)
+	_, err := enc.w.Write(data)
+	return err
+}
+
+type RequestDecoder struct {
+	r        *bufio.Reader
+	dec      encoding.RequestDecoder
+	verifier *Verifier
+	buf      [8 + sha256.Size]byte
+}
+
+func NewRequestDecoder(r io.Reader, proto encoding.Server, verifier *Verifier) *RequestDecoder {
+	// Wrapped decoder gets the same buffered reader, so the trailer can't get
+	// stuck in its buffer
+	br := bufio.NewReader(r)
+	return &RequestDecoder{
+		r:        br,
+		dec:      proto.GetRequestDecoder(br),
+		verifier: verifier,
+	}
+}
+
+func (dec *RequestDecoder) Decode(r *lottery.Request) error {
+	if err := dec.dec.Decode(r); err != nil {
+		return err
+	}
+
+	n, err := dec.r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	keyID := make([]byte, n)
+	if _, err := io.ReadFull(dec.r, keyID); err != nil {
+		return unexpectedEOF(err)
+	}
+	if _, err := io.ReadFull(dec.r, dec.buf[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	var m mac
+	ts := int64(binary.BigEndian.Uint64(dec.buf[:8]))
+	copy(m[:], dec.buf[8:])
+
+	return dec.verifier.verify(r, string(keyID), ts, m)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Server verifies requests of the wrapped server-side codec
+type Server struct {
+	Proto    encoding.Server
+	Verifier *Verifier
+}
+
+func NewServer(proto encoding.Server, verifier *Verifier) *Server {
+	return &Server{Proto: proto, Verifier: verifier}
+}
+
+func (s *Server) GetRequestDecoder(r io.Reader) encoding.RequestDecoder {
+	return NewRequestDecoder(r, s.Proto, s.Verifier)
+}
+
+func (s *Server) GetResponseEncoder(w io.Writer) encoding.ResponseEncoder {
+	return s.Proto.GetResponseEncoder(w)
+}
+
+// Client signs requests of the wrapped client-side codec
+type Client struct {
+	Proto  encoding.Client
+	Signer *Signer
+}
+
+func NewClient(proto encoding.Client, signer *Signer) *Client {
+	return &Client{Proto: proto, Signer: signer}
+}
+
+func (c *Client) GetRequestEncoder(w io.Writer) encoding.RequestEncoder {
+	return NewRequestEncoder(w, c.Proto, c.Signer)
+}
+
+func (c *Client) GetResponseDecoder(r io.Reader) encoding.ResponseDecoder {
+	return c.Proto.GetResponseDecoder(r)
+}
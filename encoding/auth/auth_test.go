@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding/plain"
+	"github.com/google/uuid"
+)
+
+var (
+	testNow     = time.Unix(1500000000, 0)
+	testSecret  = []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	testUUID, _ = uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+)
+
+func newTestVerifier(t *testing.T) *Verifier {
+	ks, err := LoadKeyStore(writeKeys(t, "alice 000102030405060708090a0b0c0d0e0f\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewVerifier(ks)
+	v.Now = func() time.Time { return testNow }
+	return v
+}
+
+func encode(t *testing.T, signer *Signer, r lottery.Request) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := NewRequestEncoder(&buf, plain.Client{}, signer).Encode(&r); err != nil {
+		t.Fatalf("RequestEncoder.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRequestDecoder_Decode(t *testing.T) {
+	req := lottery.Request{UUID: testUUID, Fee: 42, Guess: lottery.Pair{33, 35}}
+	signer := &Signer{KeyID: "alice", Secret: testSecret, Now: func() time.Time { return testNow }}
+	signed := encode(t, signer, req)
+
+	tamper := func(data []byte, i int) []byte {
+		res := append([]byte(nil), data...)
+		res[i] ^= 1
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantErr  bool
+		wantAuth bool
+	}{
+		{
+			name: "valid",
+			data: signed,
+		},
+		{
+			name:     "tampered fee",
+			data:     bytes.Replace(signed, []byte(" 42 "), []byte(" 43 "), 1),
+			wantErr:  true,
+			wantAuth: true,
+		},
+		{
+			name:     "tampered mac",
+			data:     tamper(signed, len(signed)-1),
+			wantErr:  true,
+			wantAuth: true,
+		},
+		{
+			name: "unknown key",
+			data: encode(t, &Signer{KeyID: "bob", Secret: testSecret,
+				Now: func() time.Time { return testNow }}, req),
+			wantErr:  true,
+			wantAuth: true,
+		},
+		{
+			name: "wrong secret",
+			data: encode(t, &Signer{KeyID: "alice", Secret: bytes.Repeat([]byte{1}, 16),
+				Now: func() time.Time { return testNow }}, req),
+			wantErr:  true,
+			wantAuth: true,
+		},
+		{
+			name: "expired",
+			data: encode(t, &Signer{KeyID: "alice", Secret: testSecret,
+				Now: func() time.Time { return testNow.Add(-time.Minute) }}, req),
+			wantErr:  true,
+			wantAuth: true,
+		},
+		{
+			name: "future",
+			data: encode(t, &Signer{KeyID: "alice", Secret: testSecret,
+				Now: func() time.Time { return testNow.Add(time.Minute) }}, req),
+			wantErr:  true,
+			wantAuth: true,
+		},
+		{
+			name:    "short trailer",
+			data:    signed[:len(signed)-10],
+			wantErr: true,
+		},
+		{
+			name:    "no trailer",
+			data:    signed[:len(signed)-8-32-6],
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r lottery.Request
+			dec := NewRequestDecoder(bytes.NewReader(tt.data), plain.Server{}, newTestVerifier(t))
+			err := dec.Decode(&r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RequestDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && r != req {
+				t.Errorf("RequestDecoder.Decode() {%v} != {%v}", r, req)
+			}
+			se, ok := err.(*lottery.ServerError)
+			if isAuth := ok && se.Code == lottery.CodeUnauthorized; isAuth != tt.wantAuth {
+				t.Errorf("RequestDecoder.Decode() error = %v, wantAuth %v", err, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_Replay(t *testing.T) {
+	signer := &Signer{KeyID: "alice", Secret: testSecret, Now: func() time.Time { return testNow }}
+	req := lottery.Request{UUID: testUUID, Fee: 42, Guess: lottery.Pair{33, 35}}
+	bonus := lottery.Request{UUID: testUUID, Fee: 0, Guess: lottery.Pair{1, 2}}
+
+	var data []byte
+	data = append(data, encode(t, signer, req)...)
+	data = append(data, encode(t, signer, bonus)...)
+	data = append(data, encode(t, signer, req)...)
+
+	// Verifier is shared by all connections, so replay is detected
+	// on another one as well
+	v := newTestVerifier(t)
+	dec := NewRequestDecoder(bytes.NewReader(data), plain.Server{}, v)
+	for i, want := range []bool{false, false, true} {
+		var r lottery.Request
+		if err := dec.Decode(&r); (err != nil) != want {
+			t.Errorf("Decode() #%d error = %v, wantErr %v", i, err, want)
+		}
+	}
+
+	dec = NewRequestDecoder(bytes.NewReader(encode(t, signer, bonus)), plain.Server{}, v)
+	var r lottery.Request
+	if err := dec.Decode(&r); err == nil {
+		t.Errorf("Decode() of replayed request on new connection succeeded")
+	}
+}
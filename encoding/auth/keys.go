@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// KeyStore is a set of per-player shared secrets loaded from a key file. Each
+// non-empty line of the file that doesn't start with '#' holds key ID and
+// hex encoded secret separated by whitespace:
+//
+//	# key id   secret
+//	alice      6f0c1b8a9e...
+//
+// KeyStore is safe for concurrent use
+type KeyStore struct {
+	path string
+
+	keysL sync.RWMutex
+	keys  map[string][]byte
+}
+
+// LoadKeyStore loads key store from file
+func LoadKeyStore(path string) (*KeyStore, error) {
+	ks := &KeyStore{path: path}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload re-reads the key file. Current keys are kept if it fails
+func (ks *KeyStore) Reload() error {
+	keys, err := readKeys(ks.path)
+	if err != nil {
+		return err
+	}
+
+	ks.keysL.Lock()
+	ks.keys = keys
+	ks.keysL.Unlock()
+	return nil
+}
+
+// Key returns secret for the key ID
+func (ks *KeyStore) Key(id string) ([]byte, bool) {
+	ks.keysL.RLock()
+	defer ks.keysL.RUnlock()
+
+	key, ok := ks.keys[id]
+	return key, ok
+}
+
+// Len returns number of keys in the store
+func (ks *KeyStore) Len() int {
+	ks.keysL.RLock()
+	defer ks.keysL.RUnlock()
+
+	return len(ks.keys)
+}
+
+func readKeys(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := make(map[string][]byte)
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		fields := bytes.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected key id and secret", path, n)
+		}
+		if len(fields[0]) > maxKeyIDLen {
+			return nil, fmt.Errorf("%s:%d: key id is too long", path, n)
+		}
+
+		id := string(fields[0])
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("%s:%d: duplicate key id \"%s\"", path, n, id)
+		}
+
+		secret := make([]byte, hex.DecodedLen(len(fields[1])))
+		if _, err := hex.Decode(secret, fields[1]); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid secret: %s", path, n, err)
+		}
+		if len(secret) < minSecretLen {
+			return nil, fmt.Errorf("%s:%d: secret must be at least %d bytes long", path, n, minSecretLen)
+		}
+		keys[id] = secret
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
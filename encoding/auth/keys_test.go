@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeKeys(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKeyStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		wantLen int
+	}{
+		{
+			name: "valid",
+			data: "# players\n" +
+				"alice 000102030405060708090a0b0c0d0e0f\n" +
+				"\n" +
+				"  bob\t101112131415161718191a1b1c1d1e1f  \n",
+			wantLen: 2,
+		},
+		{
+			name:    "empty",
+			data:    "",
+			wantLen: 0,
+		},
+		{
+			name:    "no secret",
+			data:    "alice\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad hex",
+			data:    "alice 000102030405060708090a0b0c0d0e0g\n",
+			wantErr: true,
+		},
+		{
+			name:    "short secret",
+			data:    "alice 0001020304\n",
+			wantErr: true,
+		},
+		{
+			name: "duplicate",
+			data: "alice 000102030405060708090a0b0c0d0e0f\n" +
+				"alice 101112131415161718191a1b1c1d1e1f\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := LoadKeyStore(writeKeys(t, tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeyStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && ks.Len() != tt.wantLen {
+				t.Errorf("LoadKeyStore() len = %d, want %d", ks.Len(), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestKeyStore_Reload(t *testing.T) {
+	path := writeKeys(t, "alice 000102030405060708090a0b0c0d0e0f\n")
+	ks, err := LoadKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("bob 101112131415161718191a1b1c1d1e1f\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, ok := ks.Key("alice"); ok {
+		t.Errorf("Key(alice) found after reload")
+	}
+	if _, ok := ks.Key("bob"); !ok {
+		t.Errorf("Key(bob) not found after reload")
+	}
+
+	// Broken file doesn't affect loaded keys
+	if err := os.WriteFile(path, []byte("bob\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Reload(); err == nil {
+		t.Errorf("Reload() of broken file succeeded")
+	}
+	if _, ok := ks.Key("bob"); !ok {
+		t.Errorf("Key(bob) not found after failed reload")
+	}
+}
@@ -0,0 +1,196 @@
+// Package binary implements a compact fixed-width wire format for lottery
+// messages.
+//
+// Request layout (26 bytes):
+//
+//	UUID  [16]byte  raw UUID bytes
+//	Fee   uint64    big endian
+//	Guess [2]byte   lucky pair
+//
+// Response layout (9 bytes):
+//
+//	Type    uint8   response type
+//	Value   uint64  big endian, jackpot for lottery.Win, error code for
+//	                lottery.Error and zero otherwise
+//
+// Error responses are followed by the message:
+//
+//	Length  uint8   message length
+//	Message []byte  error message
+package binary
+
+import (
+	bin "encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding"
+)
+
+const (
+	// RequestSize is the size of an encoded request in bytes
+	RequestSize = 16 + 8 + 2
+	// ResponseSize is the size of an encoded response in bytes
+	ResponseSize = 1 + 8
+)
+
+type RequestEncoder struct {
+	w   io.Writer
+	buf [RequestSize]byte
+}
+
+func NewRequestEncoder(w io.Writer) *RequestEncoder {
+	return &RequestEncoder{w: w}
+}
+
+func (enc *RequestEncoder) Encode(r *lottery.Request) error {
+	copy(enc.buf[:16], r.UUID[:])
+	bin.BigEndian.PutUint64(enc.buf[16:24], r.Fee)
+	copy(enc.buf[24:], r.Guess[:])
+
+	_, err := enc.w.Write(enc.buf[:])
+	return err
+}
+
+type RequestDecoder struct {
+	r   io.Reader
+	buf [RequestSize]byte
+}
+
+func NewRequestDecoder(r io.Reader) *RequestDecoder {
+	return &RequestDecoder{r: r}
+}
+
+func (dec *RequestDecoder) Decode(r *lottery.Request) error {
+	if _, err := io.ReadFull(dec.r, dec.buf[:]); err != nil {
+		return err
+	}
+
+	copy(r.UUID[:], dec.buf[:16])
+	r.Fee = bin.BigEndian.Uint64(dec.buf[16:24])
+	copy(r.Guess[:], dec.buf[24:])
+	return nil
+}
+
+type ResponseEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+func NewResponseEncoder(w io.Writer) *ResponseEncoder {
+	return &ResponseEncoder{w: w}
+}
+
+func (enc *ResponseEncoder) Encode(r *lottery.Response) error {
+	var (
+		value uint64
+		msg   string
+	)
+
+	switch r.Type {
+	case lottery.Win:
+		value = r.Jackpot
+	case lottery.Error:
+		value = uint64(r.Code)
+		msg = r.Message
+		if len(msg) > lottery.MaxMessageLen {
+			msg = msg[:lottery.MaxMessageLen]
+		}
+	case lottery.NoWin, lottery.Bonus:
+	default:
+		return fmt.Errorf("invalid value: '%d'", r.Type)
+	}
+
+	data := append(enc.buf[:0], byte(r.Type))
+	data = append(data, 0, 0, 0, 0, 0, 0, 0, 0)
+	bin.BigEndian.PutUint64(data[1:], value)
+	if r.Type == lottery.Error {
+		data = append(data, byte(len(msg)))
+		data = append(data, msg...)
+	}
+	enc.buf = data
+
+	_, err := enc.w.Write(data)
+	return err
+}
+
+type ResponseDecoder struct {
+	r   io.Reader
+	buf [ResponseSize]byte
+}
+
+func NewResponseDecoder(r io.Reader) *ResponseDecoder {
+	return &ResponseDecoder{r: r}
+}
+
+func (dec *ResponseDecoder) Decode(r *lottery.Response) error {
+	if _, err := io.ReadFull(dec.r, dec.buf[:]); err != nil {
+		return err
+	}
+
+	t := lottery.ResponseType(dec.buf[0])
+	value := bin.BigEndian.Uint64(dec.buf[1:])
+
+	*r = lottery.Response{Type: t}
+	switch t {
+	case lottery.Win:
+		r.Jackpot = value
+	case lottery.Error:
+		if value > 0xff {
+			return fmt.Errorf("invalid error code: %d", value)
+		}
+		r.Code = lottery.ErrorCode(value)
+		return dec.decodeMessage(r)
+	case lottery.NoWin, lottery.Bonus:
+		if value != 0 {
+			return fmt.Errorf("unexpected jackpot for '%s' response: %d", t, value)
+		}
+	default:
+		return fmt.Errorf("failed to parse response type: invalid value: '%d'", dec.buf[0])
+	}
+	return nil
+}
+
+func (dec *ResponseDecoder) decodeMessage(r *lottery.Response) error {
+	if _, err := io.ReadFull(dec.r, dec.buf[:1]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	msg := make([]byte, dec.buf[0])
+	if _, err := io.ReadFull(dec.r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	r.Message = string(msg)
+	return nil
+}
+
+func init() {
+	encoding.Register("binary", Server{}, Client{})
+}
+
+type Server struct{}
+
+func (Server) GetRequestDecoder(r io.Reader) encoding.RequestDecoder {
+	return NewRequestDecoder(r)
+}
+
+func (Server) GetResponseEncoder(w io.Writer) encoding.ResponseEncoder {
+	return NewResponseEncoder(w)
+}
+
+type Client struct{}
+
+func (Client) GetRequestEncoder(w io.Writer) encoding.RequestEncoder {
+	return NewRequestEncoder(w)
+}
+
+func (Client) GetResponseDecoder(r io.Reader) encoding.ResponseDecoder {
+	return NewResponseDecoder(r)
+}
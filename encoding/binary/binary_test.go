@@ -0,0 +1,514 @@
+package binary
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/google/uuid"
+)
+
+var (
+	testUUID, _  = uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	testUUIDData = []byte{
+		0x55, 0x0e, 0x84, 0x00, 0xe2, 0x9b, 0x41, 0xd4,
+		0xa7, 0x16, 0x44, 0x66, 0x55, 0x44, 0x00, 0x00,
+	}
+)
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestRequestEncoder_Encode(t *testing.T) {
+	type fields struct {
+		w *bytes.Buffer
+	}
+	type args struct {
+		r *lottery.Request
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		wantErr bool
+		buf     []byte
+	}{
+		{
+			name: "42",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Request{
+					UUID:  testUUID,
+					Fee:   42,
+					Guess: lottery.Pair{33, 35},
+				},
+			},
+			wantErr: false,
+			buf:     join(testUUIDData, []byte{0, 0, 0, 0, 0, 0, 0, 42, 33, 35}),
+		},
+		{
+			name: "MaxUint64",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Request{
+					UUID:  testUUID,
+					Fee:   math.MaxUint64,
+					Guess: lottery.Pair{33, 35},
+				},
+			},
+			wantErr: false,
+			buf:     join(testUUIDData, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 33, 35}),
+		},
+		{
+			name: "separator guess",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Request{
+					UUID:  testUUID,
+					Fee:   0,
+					Guess: lottery.Pair{' ', ' '},
+				},
+			},
+			wantErr: false,
+			buf:     join(testUUIDData, []byte{0, 0, 0, 0, 0, 0, 0, 0, ' ', ' '}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := &RequestEncoder{
+				w: tt.fields.w,
+			}
+			if err := enc.Encode(tt.args.r); (err != nil) != tt.wantErr {
+				t.Errorf("RequestEncoder.Encode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && !bytes.Equal(tt.buf, tt.fields.w.Bytes()) {
+				t.Errorf("RequestEncoder.Encode() {%x} != {%x}", tt.buf, tt.fields.w.Bytes())
+			}
+		})
+	}
+}
+
+func TestResponseEncoder_Encode(t *testing.T) {
+	type fields struct {
+		w *bytes.Buffer
+	}
+	type args struct {
+		r *lottery.Response
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		wantErr bool
+		buf     []byte
+	}{
+		{
+			name: "win",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.Win,
+					Jackpot: 42,
+				},
+			},
+			wantErr: false,
+			buf:     []byte{byte(lottery.Win), 0, 0, 0, 0, 0, 0, 0, 42},
+		},
+		{
+			name: "nowin",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.NoWin,
+					Jackpot: 0,
+				},
+			},
+			wantErr: false,
+			buf:     []byte{byte(lottery.NoWin), 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "bonus",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.Bonus,
+					Jackpot: 42,
+				},
+			},
+			wantErr: false,
+			buf:     []byte{byte(lottery.Bonus), 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "MaxUint64",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.Win,
+					Jackpot: math.MaxUint64,
+				},
+			},
+			wantErr: false,
+			buf:     []byte{byte(lottery.Win), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		},
+		{
+			name: "error",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.Error,
+					Code:    lottery.CodeBadRequest,
+					Message: "bad fee",
+				},
+			},
+			wantErr: false,
+			buf:     join([]byte{byte(lottery.Error), 0, 0, 0, 0, 0, 0, 0, byte(lottery.CodeBadRequest), 7}, []byte("bad fee")),
+		},
+		{
+			name: "wrong type",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.ResponseType(42),
+					Jackpot: math.MaxUint64,
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := &ResponseEncoder{
+				w: tt.fields.w,
+			}
+			if err := enc.Encode(tt.args.r); (err != nil) != tt.wantErr {
+				t.Errorf("ResponseEncoder.Encode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && !bytes.Equal(tt.buf, tt.fields.w.Bytes()) {
+				t.Errorf("ResponseEncoder.Encode() {%x} != {%x}", tt.buf, tt.fields.w.Bytes())
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_Decode(t *testing.T) {
+	type fields struct {
+		r *bytes.Reader
+	}
+	type args struct {
+		r *lottery.Request
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		wantErr bool
+		res     lottery.Request
+	}{
+		{
+			name: "42",
+			fields: fields{
+				r: bytes.NewReader(join(testUUIDData, []byte{0, 0, 0, 0, 0, 0, 0, 42, 33, 35})),
+			},
+			args: args{
+				r: &lottery.Request{},
+			},
+			wantErr: false,
+			res: lottery.Request{
+				UUID:  testUUID,
+				Fee:   42,
+				Guess: lottery.Pair{33, 35},
+			},
+		},
+		{
+			name: "MaxUint64",
+			fields: fields{
+				r: bytes.NewReader(join(testUUIDData, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 33, 35})),
+			},
+			args: args{
+				r: &lottery.Request{},
+			},
+			wantErr: false,
+			res: lottery.Request{
+				UUID:  testUUID,
+				Fee:   math.MaxUint64,
+				Guess: lottery.Pair{33, 35},
+			},
+		},
+		{
+			name: "separator guess",
+			fields: fields{
+				r: bytes.NewReader(join(testUUIDData, []byte{0, 0, 0, 0, 0, 0, 0, 1, ' ', ' '})),
+			},
+			args: args{
+				r: &lottery.Request{},
+			},
+			wantErr: false,
+			res: lottery.Request{
+				UUID:  testUUID,
+				Fee:   1,
+				Guess: lottery.Pair{' ', ' '},
+			},
+		},
+		{
+			name: "short guess",
+			fields: fields{
+				r: bytes.NewReader(join(testUUIDData, []byte{0, 0, 0, 0, 0, 0, 0, 42, 33})),
+			},
+			args: args{
+				r: &lottery.Request{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "short fee",
+			fields: fields{
+				r: bytes.NewReader(join(testUUIDData, []byte{0, 0, 0, 0})),
+			},
+			args: args{
+				r: &lottery.Request{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "short uuid",
+			fields: fields{
+				r: bytes.NewReader(testUUIDData[:10]),
+			},
+			args: args{
+				r: &lottery.Request{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty",
+			fields: fields{
+				r: bytes.NewReader(nil),
+			},
+			args: args{
+				r: &lottery.Request{},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := &RequestDecoder{
+				r: tt.fields.r,
+			}
+			if err := dec.Decode(tt.args.r); (err != nil) != tt.wantErr {
+				t.Errorf("RequestDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.res != *tt.args.r {
+				t.Errorf("RequestDecoder.Decode() {%v} != {%v}", tt.res, *tt.args.r)
+			}
+		})
+	}
+}
+
+func TestResponseDecoder_Decode(t *testing.T) {
+	type fields struct {
+		r *bytes.Reader
+	}
+	type args struct {
+		r *lottery.Response
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		wantErr bool
+		res     lottery.Response
+	}{
+		{
+			name: "win",
+			fields: fields{
+				r: bytes.NewReader([]byte{byte(lottery.Win), 0, 0, 0, 0, 0, 0, 0, 42}),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: 42,
+			},
+		},
+		{
+			name: "nowin",
+			fields: fields{
+				r: bytes.NewReader([]byte{byte(lottery.NoWin), 0, 0, 0, 0, 0, 0, 0, 0}),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.NoWin,
+				Jackpot: 0,
+			},
+		},
+		{
+			name: "bonus",
+			fields: fields{
+				r: bytes.NewReader([]byte{byte(lottery.Bonus), 0, 0, 0, 0, 0, 0, 0, 0}),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Bonus,
+				Jackpot: 0,
+			},
+		},
+		{
+			name: "MaxUint64",
+			fields: fields{
+				r: bytes.NewReader([]byte{byte(lottery.Win), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: math.MaxUint64,
+			},
+		},
+		{
+			name: "error",
+			fields: fields{
+				r: bytes.NewReader(join([]byte{byte(lottery.Error), 0, 0, 0, 0, 0, 0, 0, byte(lottery.CodeBadRequest), 7}, []byte("bad fee"))),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Error,
+				Code:    lottery.CodeBadRequest,
+				Message: "bad fee",
+			},
+		},
+		{
+			name: "error short message",
+			fields: fields{
+				r: bytes.NewReader(join([]byte{byte(lottery.Error), 0, 0, 0, 0, 0, 0, 0, byte(lottery.CodeBadRequest), 7}, []byte("bad"))),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "error no length",
+			fields: fields{
+				r: bytes.NewReader([]byte{byte(lottery.Error), 0, 0, 0, 0, 0, 0, 0, byte(lottery.CodeBadRequest)}),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "error bad code",
+			fields: fields{
+				r: bytes.NewReader([]byte{byte(lottery.Error), 0, 0, 0, 0, 0, 0, 1, 0, 0}),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "nowin with jackpot",
+			fields: fields{
+				r: bytes.NewReader([]byte{byte(lottery.NoWin), 0, 0, 0, 0, 0, 0, 0, 42}),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong type",
+			fields: fields{
+				r: bytes.NewReader([]byte{42, 0, 0, 0, 0, 0, 0, 0, 0}),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "short message",
+			fields: fields{
+				r: bytes.NewReader([]byte{byte(lottery.Win), 0, 0, 0}),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := &ResponseDecoder{
+				r: tt.fields.r,
+			}
+			if err := dec.Decode(tt.args.r); (err != nil) != tt.wantErr {
+				t.Errorf("ResponseDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.res != *tt.args.r {
+				t.Errorf("ResponseDecoder.Decode() {%v} != {%v}", tt.res, *tt.args.r)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	reqs := []lottery.Request{
+		{UUID: testUUID, Fee: 0, Guess: lottery.Pair{0, 0}},
+		{UUID: testUUID, Fee: 150, Guess: lottery.Pair{' ', '\n'}},
+		{UUID: testUUID, Fee: math.MaxUint64, Guess: lottery.Pair{0xff, 0xff}},
+	}
+
+	enc := Client{}.GetRequestEncoder(&buf)
+	for i := range reqs {
+		if err := enc.Encode(&reqs[i]); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+	}
+	if buf.Len() != len(reqs)*RequestSize {
+		t.Fatalf("encoded %d bytes, want %d", buf.Len(), len(reqs)*RequestSize)
+	}
+
+	dec := Server{}.GetRequestDecoder(&buf)
+	for _, want := range reqs {
+		var got lottery.Request
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Decode() {%v} != {%v}", got, want)
+		}
+	}
+}
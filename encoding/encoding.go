@@ -1,6 +1,7 @@
 package encoding
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/bpiddubnyi/lottery"
@@ -37,9 +38,27 @@ type Server interface {
 	GetResponseEncoder(w io.Writer) ResponseEncoder
 }
 
+// Interactive is implemented by server-side codecs typed by hand, like
+// line. Their connections time out when the client is idle, rather than
+// on the total connection time
+type Interactive interface {
+	Server
+	Interactive()
+}
+
 // Client is an interface for getting client-side
 // encoder-decoder pair
 type Client interface {
 	GetRequestEncoder(w io.Writer) RequestEncoder
 	GetResponseDecoder(r io.Reader) ResponseDecoder
 }
+
+// MessageError is returned by decoders which have skipped a malformed message
+// and stay in sync with the stream, so the next message can be decoded
+type MessageError struct {
+	Err error
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("message skipped: %s", e.Err)
+}
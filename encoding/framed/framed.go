@@ -0,0 +1,252 @@
+// Package framed implements a decorator which puts every message of the
+// wrapped codec into a frame prefixed with its uvarint encoded length:
+//
+//	length  uvarint  payload length
+//	payload []byte   message encoded by the wrapped codec
+//
+// Since frame boundaries are known in advance, decoders are able to skip
+// oversize or malformed messages and stay in sync with the stream. Skipped
+// frames are reported with *encoding.MessageError. Frames over maxSkipFactor
+// times the maximum size aren't worth reading, they fail the stream.
+package framed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding"
+)
+
+const (
+	// DefaultMaxSize is the default maximum frame payload size
+	DefaultMaxSize = 4096
+
+	payloadBufferSize = 4096
+
+	// Oversize frames up to this many times the maximum size are skipped
+	maxSkipFactor = 4
+)
+
+var (
+	// ErrFrameTooLarge is returned when frame payload exceeds maximum size
+	ErrFrameTooLarge = errors.New("frame too large")
+)
+
+type frameWriter struct {
+	w       io.Writer
+	maxSize int
+	buf     bytes.Buffer
+	hdr     [binary.MaxVarintLen64]byte
+}
+
+func (fw *frameWriter) flush() error {
+	defer fw.buf.Reset()
+
+	if fw.buf.Len() > fw.maxSize {
+		return ErrFrameTooLarge
+	}
+
+	n := binary.PutUvarint(fw.hdr[:], uint64(fw.buf.Len()))
+	data := make([]byte, 0, n+fw.buf.Len())
+	data = append(data, fw.hdr[:n]...)
+	data = append(data, fw.buf.Bytes()...)
+
+	_, err := fw.w.Write(data)
+	return err
+}
+
+type frameReader struct {
+	r       *bufio.Reader
+	maxSize int
+	buf     []byte
+	frame   bytes.Reader
+	// Wrapped decoders get the frame through a buffered reader, so codecs
+	// that buffer input reuse it and leftovers stay visible to remaining()
+	payload *bufio.Reader
+}
+
+func newFrameReader(r io.Reader, maxSize int) frameReader {
+	return frameReader{
+		r:       bufio.NewReader(r),
+		maxSize: maxSize,
+		payload: bufio.NewReaderSize(nil, payloadBufferSize),
+	}
+}
+
+// next reads next frame payload. Oversize frames are discarded, unless
+// they're too large to bother
+func (fr *frameReader) next() (*bufio.Reader, error) {
+	n, err := binary.ReadUvarint(fr.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read frame length: %s", err)
+	}
+
+	if n > uint64(fr.maxSize) {
+		if n/maxSkipFactor > uint64(fr.maxSize) {
+			return nil, ErrFrameTooLarge
+		}
+		if _, err := io.CopyN(io.Discard, fr.r, int64(n)); err != nil {
+			return nil, err
+		}
+		return nil, &encoding.MessageError{Err: ErrFrameTooLarge}
+	}
+
+	if cap(fr.buf) < int(n) {
+		fr.buf = make([]byte, n)
+	}
+	fr.buf = fr.buf[:n]
+
+	if _, err := io.ReadFull(fr.r, fr.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	fr.frame.Reset(fr.buf)
+	fr.payload.Reset(&fr.frame)
+	return fr.payload, nil
+}
+
+// remaining returns number of frame bytes not consumed by the decoder
+func (fr *frameReader) remaining() int {
+	return fr.payload.Buffered() + fr.frame.Len()
+}
+
+type RequestEncoder struct {
+	fw  frameWriter
+	enc encoding.RequestEncoder
+}
+
+func NewRequestEncoder(w io.Writer, proto encoding.Client, maxSize int) *RequestEncoder {
+	enc := &RequestEncoder{fw: frameWriter{w: w, maxSize: maxSize}}
+	enc.enc = proto.GetRequestEncoder(&enc.fw.buf)
+	return enc
+}
+
+func (enc *RequestEncoder) Encode(r *lottery.Request) error {
+	if err := enc.enc.Encode(r); err != nil {
+		enc.fw.buf.Reset()
+		return err
+	}
+	return enc.fw.flush()
+}
+
+type RequestDecoder struct {
+	fr    frameReader
+	proto encoding.Server
+}
+
+func NewRequestDecoder(r io.Reader, proto encoding.Server, maxSize int) *RequestDecoder {
+	return &RequestDecoder{
+		fr:    newFrameReader(r, maxSize),
+		proto: proto,
+	}
+}
+
+func (dec *RequestDecoder) Decode(r *lottery.Request) error {
+	frame, err := dec.fr.next()
+	if err != nil {
+		return err
+	}
+
+	// Wrapped decoders may keep state, so a fresh one is used for every
+	// frame to make sure nothing leaks into the next message
+	if err := dec.proto.GetRequestDecoder(frame).Decode(r); err != nil {
+		return &encoding.MessageError{Err: err}
+	}
+	if n := dec.fr.remaining(); n != 0 {
+		return &encoding.MessageError{Err: fmt.Errorf("%d trailing bytes", n)}
+	}
+	return nil
+}
+
+type ResponseEncoder struct {
+	fw  frameWriter
+	enc encoding.ResponseEncoder
+}
+
+func NewResponseEncoder(w io.Writer, proto encoding.Server, maxSize int) *ResponseEncoder {
+	enc := &ResponseEncoder{fw: frameWriter{w: w, maxSize: maxSize}}
+	enc.enc = proto.GetResponseEncoder(&enc.fw.buf)
+	return enc
+}
+
+func (enc *ResponseEncoder) Encode(r *lottery.Response) error {
+	if err := enc.enc.Encode(r); err != nil {
+		enc.fw.buf.Reset()
+		return err
+	}
+	return enc.fw.flush()
+}
+
+type ResponseDecoder struct {
+	fr    frameReader
+	proto encoding.Client
+}
+
+func NewResponseDecoder(r io.Reader, proto encoding.Client, maxSize int) *ResponseDecoder {
+	return &ResponseDecoder{
+		fr:    newFrameReader(r, maxSize),
+		proto: proto,
+	}
+}
+
+func (dec *ResponseDecoder) Decode(r *lottery.Response) error {
+	frame, err := dec.fr.next()
+	if err != nil {
+		return err
+	}
+
+	if err := dec.proto.GetResponseDecoder(frame).Decode(r); err != nil {
+		return &encoding.MessageError{Err: err}
+	}
+	if n := dec.fr.remaining(); n != 0 {
+		return &encoding.MessageError{Err: fmt.Errorf("%d trailing bytes", n)}
+	}
+	return nil
+}
+
+// Server wraps server-side codec with framing
+type Server struct {
+	Proto   encoding.Server
+	MaxSize int
+}
+
+func NewServer(proto encoding.Server, maxSize int) *Server {
+	return &Server{Proto: proto, MaxSize: maxSize}
+}
+
+func (s *Server) GetRequestDecoder(r io.Reader) encoding.RequestDecoder {
+	return NewRequestDecoder(r, s.Proto, s.MaxSize)
+}
+
+func (s *Server) GetResponseEncoder(w io.Writer) encoding.ResponseEncoder {
+	return NewResponseEncoder(w, s.Proto, s.MaxSize)
+}
+
+// Client wraps client-side codec with framing
+type Client struct {
+	Proto   encoding.Client
+	MaxSize int
+}
+
+func NewClient(proto encoding.Client, maxSize int) *Client {
+	return &Client{Proto: proto, MaxSize: maxSize}
+}
+
+func (c *Client) GetRequestEncoder(w io.Writer) encoding.RequestEncoder {
+	return NewRequestEncoder(w, c.Proto, c.MaxSize)
+}
+
+func (c *Client) GetResponseDecoder(r io.Reader) encoding.ResponseDecoder {
+	return NewResponseDecoder(r, c.Proto, c.MaxSize)
+}
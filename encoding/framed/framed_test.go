@@ -0,0 +1,281 @@
+package framed
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding"
+	"github.com/bpiddubnyi/lottery/encoding/plain"
+	"github.com/google/uuid"
+)
+
+func frame(payload string) []byte {
+	return append([]byte{byte(len(payload))}, payload...)
+}
+
+func TestRequestEncoder_Encode(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	tests := []struct {
+		name    string
+		maxSize int
+		r       *lottery.Request
+		wantErr bool
+		buf     []byte
+	}{
+		{
+			name:    "42",
+			maxSize: DefaultMaxSize,
+			r: &lottery.Request{
+				UUID:  id,
+				Fee:   42,
+				Guess: lottery.Pair{33, 35},
+			},
+			wantErr: false,
+			buf:     frame("550e8400-e29b-41d4-a716-446655440000 42 !#"),
+		},
+		{
+			name:    "too large",
+			maxSize: 10,
+			r: &lottery.Request{
+				UUID:  id,
+				Fee:   math.MaxUint64,
+				Guess: lottery.Pair{33, 35},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			enc := NewRequestEncoder(w, plain.Client{}, tt.maxSize)
+			if err := enc.Encode(tt.r); (err != nil) != tt.wantErr {
+				t.Errorf("RequestEncoder.Encode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && !bytes.Equal(tt.buf, w.Bytes()) {
+				t.Errorf("RequestEncoder.Encode() {%q} != {%q}", tt.buf, w.Bytes())
+			}
+		})
+	}
+}
+
+func TestResponseEncoder_Encode(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		r       *lottery.Response
+		wantErr bool
+		buf     []byte
+	}{
+		{
+			name:    "win",
+			maxSize: DefaultMaxSize,
+			r: &lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: 42,
+			},
+			wantErr: false,
+			buf:     frame("win 42 "),
+		},
+		{
+			name:    "nowin",
+			maxSize: DefaultMaxSize,
+			r: &lottery.Response{
+				Type: lottery.NoWin,
+			},
+			wantErr: false,
+			buf:     frame("nowin "),
+		},
+		{
+			name:    "wrong type",
+			maxSize: DefaultMaxSize,
+			r: &lottery.Response{
+				Type: lottery.ResponseType(42),
+			},
+			wantErr: true,
+		},
+		{
+			name:    "too large",
+			maxSize: 3,
+			r: &lottery.Response{
+				Type: lottery.Bonus,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			enc := NewResponseEncoder(w, plain.Server{}, tt.maxSize)
+			if err := enc.Encode(tt.r); (err != nil) != tt.wantErr {
+				t.Errorf("ResponseEncoder.Encode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && !bytes.Equal(tt.buf, w.Bytes()) {
+				t.Errorf("ResponseEncoder.Encode() {%q} != {%q}", tt.buf, w.Bytes())
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_Decode(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	tests := []struct {
+		name      string
+		data      []byte
+		wantErr   bool
+		wantFrame bool
+		res       lottery.Request
+	}{
+		{
+			name:    "42",
+			data:    frame("550e8400-e29b-41d4-a716-446655440000 42 !#"),
+			wantErr: false,
+			res: lottery.Request{
+				UUID:  id,
+				Fee:   42,
+				Guess: lottery.Pair{33, 35},
+			},
+		},
+		{
+			name:      "bad fee",
+			data:      frame("550e8400-e29b-41d4-a716-446655440000 bad !#"),
+			wantErr:   true,
+			wantFrame: true,
+		},
+		{
+			name:      "trailing bytes",
+			data:      frame("550e8400-e29b-41d4-a716-446655440000 42 !#!#"),
+			wantErr:   true,
+			wantFrame: true,
+		},
+		{
+			name:      "too large",
+			data:      append([]byte{0x80, 0x01}, make([]byte, 128)...),
+			wantErr:   true,
+			wantFrame: true,
+		},
+		{
+			name:    "too large to skip",
+			data:    append([]byte{0xe8, 0x07}, make([]byte, 1000)...),
+			wantErr: true,
+		},
+		{
+			name:    "short frame",
+			data:    frame("550e8400-e29b-41d4-a716-446655440000 42 !#")[:20],
+			wantErr: true,
+		},
+		{
+			name:    "short length",
+			data:    []byte{0x80},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r lottery.Request
+			dec := NewRequestDecoder(bytes.NewReader(tt.data), plain.Server{}, 100)
+			err := dec.Decode(&r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RequestDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.res != r {
+				t.Errorf("RequestDecoder.Decode() {%v} != {%v}", tt.res, r)
+			}
+			if _, ok := err.(*encoding.MessageError); ok != tt.wantFrame {
+				t.Errorf("RequestDecoder.Decode() error = %v, wantFrame %v", err, tt.wantFrame)
+			}
+		})
+	}
+}
+
+func TestResponseDecoder_Decode(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		wantErr   bool
+		wantFrame bool
+		res       lottery.Response
+	}{
+		{
+			name:    "win",
+			data:    frame("win 42 "),
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: 42,
+			},
+		},
+		{
+			name:    "bonus",
+			data:    frame("bonus "),
+			wantErr: false,
+			res: lottery.Response{
+				Type: lottery.Bonus,
+			},
+		},
+		{
+			name:      "wrong type",
+			data:      frame("winwin 42 "),
+			wantErr:   true,
+			wantFrame: true,
+		},
+		{
+			name:      "win no jackpot",
+			data:      frame("win "),
+			wantErr:   true,
+			wantFrame: true,
+		},
+		{
+			name:    "empty",
+			data:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r lottery.Response
+			dec := NewResponseDecoder(bytes.NewReader(tt.data), plain.Client{}, 100)
+			err := dec.Decode(&r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResponseDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.res != r {
+				t.Errorf("ResponseDecoder.Decode() {%v} != {%v}", tt.res, r)
+			}
+			if _, ok := err.(*encoding.MessageError); ok != tt.wantFrame {
+				t.Errorf("ResponseDecoder.Decode() error = %v, wantFrame %v", err, tt.wantFrame)
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_Resync(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	want := lottery.Request{UUID: id, Fee: 42, Guess: lottery.Pair{' ', ' '}}
+
+	var data []byte
+	data = append(data, frame("garbage")...)
+	data = append(data, 0x80, 0x01)
+	data = append(data, make([]byte, 128)...)
+	data = append(data, frame("550e8400-e29b-41d4-a716-446655440000 42   ")...)
+
+	dec := NewRequestDecoder(bytes.NewReader(data), plain.Server{}, 100)
+	for i := 0; i < 2; i++ {
+		var r lottery.Request
+		if err := dec.Decode(&r); err == nil {
+			t.Fatalf("Decode() of bad frame %d succeeded", i)
+		} else if _, ok := err.(*encoding.MessageError); !ok {
+			t.Fatalf("Decode() error = %v, want *encoding.MessageError", err)
+		}
+	}
+
+	var got lottery.Request
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("Decode() {%v} != {%v}", got, want)
+	}
+
+	if err := dec.Decode(&got); err != io.EOF {
+		t.Errorf("Decode() error = %v, want EOF", err)
+	}
+}
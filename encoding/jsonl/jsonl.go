@@ -0,0 +1,167 @@
+// Package jsonl implements a newline-delimited JSON wire format for lottery
+// messages. Every message is a single JSON object terminated by '\n':
+//
+//	{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":42,"guess":"12:200"}
+//	{"type":"win","jackpot":1234}
+//	{"type":"error","code":2,"message":"bad request"}
+package jsonl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding"
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxLineSize is the maximum length of a single message line
+	MaxLineSize = 1024
+)
+
+var (
+	errLineTooLong = errors.New("line too long")
+)
+
+type RequestEncoder struct {
+	enc *json.Encoder
+}
+
+func NewRequestEncoder(w io.Writer) *RequestEncoder {
+	return &RequestEncoder{enc: json.NewEncoder(w)}
+}
+
+func (enc *RequestEncoder) Encode(r *lottery.Request) error {
+	return enc.enc.Encode(r)
+}
+
+// request is lottery.Request with pointer fields, so missing fields aren't
+// taken for zero values
+type request struct {
+	UUID  *uuid.UUID    `json:"uuid"`
+	Fee   *uint64       `json:"fee"`
+	Guess *lottery.Pair `json:"guess"`
+}
+
+type RequestDecoder struct {
+	r *bufio.Reader
+}
+
+func NewRequestDecoder(r io.Reader) *RequestDecoder {
+	return &RequestDecoder{r: bufio.NewReaderSize(r, MaxLineSize)}
+}
+
+func (dec *RequestDecoder) Decode(r *lottery.Request) error {
+	line, err := readLine(dec.r)
+	if err != nil {
+		return err
+	}
+
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return err
+	}
+	switch {
+	case req.UUID == nil:
+		return errors.New("missing uuid field")
+	case req.Fee == nil:
+		return errors.New("missing fee field")
+	case req.Guess == nil:
+		return errors.New("missing guess field")
+	}
+
+	*r = lottery.Request{UUID: *req.UUID, Fee: *req.Fee, Guess: *req.Guess}
+	return nil
+}
+
+type ResponseEncoder struct {
+	enc *json.Encoder
+}
+
+func NewResponseEncoder(w io.Writer) *ResponseEncoder {
+	return &ResponseEncoder{enc: json.NewEncoder(w)}
+}
+
+func (enc *ResponseEncoder) Encode(r *lottery.Response) error {
+	switch r.Type {
+	case lottery.Win:
+		r = &lottery.Response{Type: r.Type, Jackpot: r.Jackpot}
+	case lottery.Error:
+		msg := r.Message
+		if len(msg) > lottery.MaxMessageLen {
+			msg = msg[:lottery.MaxMessageLen]
+		}
+		r = &lottery.Response{Type: r.Type, Code: r.Code, Message: msg}
+	default:
+		r = &lottery.Response{Type: r.Type}
+	}
+	return enc.enc.Encode(r)
+}
+
+type ResponseDecoder struct {
+	r *bufio.Reader
+}
+
+func NewResponseDecoder(r io.Reader) *ResponseDecoder {
+	return &ResponseDecoder{r: bufio.NewReaderSize(r, MaxLineSize)}
+}
+
+func (dec *ResponseDecoder) Decode(r *lottery.Response) error {
+	line, err := readLine(dec.r)
+	if err != nil {
+		return err
+	}
+
+	*r = lottery.Response{}
+	return json.Unmarshal(line, r)
+}
+
+// readLine returns the next line without the trailing newline. The returned
+// slice is only valid until the next read. r may be buffered beyond
+// MaxLineSize, so the length is checked as well.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	switch err {
+	case nil:
+		if len(line) > MaxLineSize {
+			return nil, errLineTooLong
+		}
+		return line[:len(line)-1], nil
+	case bufio.ErrBufferFull:
+		return nil, errLineTooLong
+	case io.EOF:
+		if len(line) != 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	default:
+		return nil, err
+	}
+}
+
+func init() {
+	encoding.Register("jsonl", Server{}, Client{})
+}
+
+type Server struct{}
+
+func (Server) GetRequestDecoder(r io.Reader) encoding.RequestDecoder {
+	return NewRequestDecoder(r)
+}
+
+func (Server) GetResponseEncoder(w io.Writer) encoding.ResponseEncoder {
+	return NewResponseEncoder(w)
+}
+
+type Client struct{}
+
+func (Client) GetRequestEncoder(w io.Writer) encoding.RequestEncoder {
+	return NewRequestEncoder(w)
+}
+
+func (Client) GetResponseDecoder(r io.Reader) encoding.ResponseDecoder {
+	return NewResponseDecoder(r)
+}
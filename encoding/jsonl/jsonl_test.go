@@ -0,0 +1,389 @@
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/google/uuid"
+)
+
+func TestRequestEncoder_Encode(t *testing.T) {
+	type args struct {
+		r *lottery.Request
+	}
+
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+		buf     []byte
+	}{
+		{
+			name: "42",
+			args: args{
+				r: &lottery.Request{
+					UUID:  id,
+					Fee:   42,
+					Guess: lottery.Pair{12, 200},
+				},
+			},
+			wantErr: false,
+			buf:     []byte(`{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":42,"guess":"12:200"}` + "\n"),
+		},
+		{
+			name: "MaxUint64",
+			args: args{
+				r: &lottery.Request{
+					UUID:  id,
+					Fee:   math.MaxUint64,
+					Guess: lottery.Pair{32, 10},
+				},
+			},
+			wantErr: false,
+			buf:     []byte(`{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":18446744073709551615,"guess":"32:10"}` + "\n"),
+		},
+		{
+			name: "zero",
+			args: args{
+				r: &lottery.Request{
+					UUID:  id,
+					Fee:   0,
+					Guess: lottery.Pair{0, 0},
+				},
+			},
+			wantErr: false,
+			buf:     []byte(`{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":0,"guess":"0:0"}` + "\n"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			enc := NewRequestEncoder(w)
+			if err := enc.Encode(tt.args.r); (err != nil) != tt.wantErr {
+				t.Errorf("RequestEncoder.Encode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && !bytes.Equal(tt.buf, w.Bytes()) {
+				t.Errorf("RequestEncoder.Encode() {%s} != {%s}", string(tt.buf), w.String())
+			}
+		})
+	}
+}
+
+func TestResponseEncoder_Encode(t *testing.T) {
+	type args struct {
+		r *lottery.Response
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+		buf     []byte
+	}{
+		{
+			name: "win",
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.Win,
+					Jackpot: 42,
+				},
+			},
+			wantErr: false,
+			buf:     []byte(`{"type":"win","jackpot":42}` + "\n"),
+		},
+		{
+			name: "nowin",
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.NoWin,
+					Jackpot: 0,
+				},
+			},
+			wantErr: false,
+			buf:     []byte(`{"type":"nowin"}` + "\n"),
+		},
+		{
+			name: "bonus",
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.Bonus,
+					Jackpot: 42,
+				},
+			},
+			wantErr: false,
+			buf:     []byte(`{"type":"bonus"}` + "\n"),
+		},
+		{
+			name: "MaxUint64",
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.Win,
+					Jackpot: math.MaxUint64,
+				},
+			},
+			wantErr: false,
+			buf:     []byte(`{"type":"win","jackpot":18446744073709551615}` + "\n"),
+		},
+		{
+			name: "error",
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.Error,
+					Code:    lottery.CodeBadRequest,
+					Message: "bad fee",
+				},
+			},
+			wantErr: false,
+			buf:     []byte(`{"type":"error","code":2,"message":"bad fee"}` + "\n"),
+		},
+		{
+			name: "wrong type",
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.ResponseType(42),
+					Jackpot: math.MaxUint64,
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			enc := NewResponseEncoder(w)
+			if err := enc.Encode(tt.args.r); (err != nil) != tt.wantErr {
+				t.Errorf("ResponseEncoder.Encode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && !bytes.Equal(tt.buf, w.Bytes()) {
+				t.Errorf("ResponseEncoder.Encode() {%s} != {%s}", string(tt.buf), w.String())
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_Decode(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		res     lottery.Request
+	}{
+		{
+			name:    "42",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":42,"guess":"12:200"}` + "\n",
+			wantErr: false,
+			res: lottery.Request{
+				UUID:  id,
+				Fee:   42,
+				Guess: lottery.Pair{12, 200},
+			},
+		},
+		{
+			name:    "MaxUint64",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":18446744073709551615,"guess":"32:10"}` + "\n",
+			wantErr: false,
+			res: lottery.Request{
+				UUID:  id,
+				Fee:   math.MaxUint64,
+				Guess: lottery.Pair{32, 10},
+			},
+		},
+		{
+			name:    "bad UUID",
+			data:    `{"uuid":"550e8400-e29b-a716-446655440000","fee":42,"guess":"12:200"}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad fee",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":"bad","guess":"12:200"}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "negative fee",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":-1,"guess":"12:200"}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad guess",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":42,"guess":"12:256"}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "short guess",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":42,"guess":"12"}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty object",
+			data:    "{}\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing uuid",
+			data:    `{"fee":42,"guess":"12:200"}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing fee",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","guess":"12:200"}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing guess",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":42}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "null guess",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":42,"guess":null}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "no newline",
+			data:    `{"uuid":"550e8400-e29b-41d4-a716-446655440000","fee":42,"guess":"12:200"}`,
+			wantErr: true,
+		},
+		{
+			name:    "too long",
+			data:    `{"uuid":"` + strings.Repeat("0", MaxLineSize) + `"}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			data:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r lottery.Request
+			dec := NewRequestDecoder(strings.NewReader(tt.data))
+			if err := dec.Decode(&r); (err != nil) != tt.wantErr {
+				t.Errorf("RequestDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.res != r {
+				t.Errorf("RequestDecoder.Decode() {%v} != {%v}", tt.res, r)
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_LongLine(t *testing.T) {
+	// Server passes a reader buffered beyond MaxLineSize
+	data := `{"uuid":"` + strings.Repeat("0", MaxLineSize) + `"}` + "\n"
+	dec := NewRequestDecoder(bufio.NewReaderSize(strings.NewReader(data), 4096))
+
+	var r lottery.Request
+	if err := dec.Decode(&r); err != errLineTooLong {
+		t.Errorf("RequestDecoder.Decode() error = %v, want %v", err, errLineTooLong)
+	}
+}
+
+func TestResponseDecoder_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		res     lottery.Response
+	}{
+		{
+			name:    "win",
+			data:    `{"type":"win","jackpot":42}` + "\n",
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: 42,
+			},
+		},
+		{
+			name:    "nowin",
+			data:    `{"type":"nowin"}` + "\n",
+			wantErr: false,
+			res: lottery.Response{
+				Type: lottery.NoWin,
+			},
+		},
+		{
+			name:    "bonus",
+			data:    `{"type":"bonus"}` + "\n",
+			wantErr: false,
+			res: lottery.Response{
+				Type: lottery.Bonus,
+			},
+		},
+		{
+			name:    "MaxUint64",
+			data:    `{"type":"win","jackpot":18446744073709551615}` + "\n",
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: math.MaxUint64,
+			},
+		},
+		{
+			name:    "error",
+			data:    `{"type":"error","code":2,"message":"bad fee"}` + "\n",
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Error,
+				Code:    lottery.CodeBadRequest,
+				Message: "bad fee",
+			},
+		},
+		{
+			name:    "wrong type",
+			data:    `{"type":"winwin","jackpot":42}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			data:    `win 42` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "short message",
+			data:    `{"type":"win"`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r lottery.Response
+			dec := NewResponseDecoder(strings.NewReader(tt.data))
+			if err := dec.Decode(&r); (err != nil) != tt.wantErr {
+				t.Errorf("ResponseDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.res != r {
+				t.Errorf("ResponseDecoder.Decode() {%v} != {%v}", tt.res, r)
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_DecodeStream(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	reqs := []lottery.Request{
+		{UUID: id, Fee: 150, Guess: lottery.Pair{1, 2}},
+		{UUID: id, Fee: 0, Guess: lottery.Pair{255, 32}},
+	}
+
+	var buf bytes.Buffer
+	enc := NewRequestEncoder(&buf)
+	for i := range reqs {
+		if err := enc.Encode(&reqs[i]); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+	}
+
+	dec := NewRequestDecoder(&buf)
+	for _, want := range reqs {
+		var got lottery.Request
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Decode() {%v} != {%v}", got, want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Package line implements a human-typable line protocol suitable for telnet
+// and expect scripts. A client sends commands:
+//
+//	PLAY <uuid> <fee> <a>:<b>
+//
+// and the server answers with one of:
+//
+//	WIN <jackpot>
+//	NOWIN
+//	BONUS
+//	ERROR <code> <message>
+//
+// Lines are terminated with "\r\n", a bare "\n" is accepted as well. Commands
+// are case-insensitive and blank lines are ignored. Malformed lines are
+// reported with *encoding.MessageError, so the next line can still be read.
+package line
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding"
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxLineSize is the maximum length of a single line
+	MaxLineSize = 512
+)
+
+var (
+	playB  = []byte("PLAY")
+	winB   = []byte("WIN")
+	noWinB = []byte("NOWIN")
+	bonusB = []byte("BONUS")
+	errorB = []byte("ERROR")
+
+	crlf = []byte("\r\n")
+
+	errLineTooLong = errors.New("line too long")
+)
+
+// readLine returns the next non-blank line split into fields. r may be
+// buffered beyond MaxLineSize, so the length is checked as well
+func readLine(r *bufio.Reader) ([][]byte, error) {
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Skip the rest of the line to stay in sync
+			for err == bufio.ErrBufferFull {
+				_, err = r.ReadSlice('\n')
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, &encoding.MessageError{Err: errLineTooLong}
+		}
+		if err != nil {
+			if err == io.EOF && len(line) != 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if len(line) > MaxLineSize {
+			return nil, &encoding.MessageError{Err: errLineTooLong}
+		}
+
+		if fields := bytes.Fields(line); len(fields) != 0 {
+			return fields, nil
+		}
+	}
+}
+
+type RequestEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+func NewRequestEncoder(w io.Writer) *RequestEncoder {
+	return &RequestEncoder{w: w}
+}
+
+func (enc *RequestEncoder) Encode(r *lottery.Request) error {
+	data := append(enc.buf[:0], playB...)
+	data = append(data, ' ')
+	data = append(data, r.UUID.String()...)
+	data = append(data, ' ')
+	data = strconv.AppendUint(data, r.Fee, 10)
+	data = append(data, ' ')
+	data = append(data, r.Guess.String()...)
+	data = append(data, crlf...)
+	enc.buf = data
+
+	_, err := enc.w.Write(data)
+	return err
+}
+
+type RequestDecoder struct {
+	r *bufio.Reader
+}
+
+func NewRequestDecoder(r io.Reader) *RequestDecoder {
+	return &RequestDecoder{r: bufio.NewReaderSize(r, MaxLineSize)}
+}
+
+func (dec *RequestDecoder) Decode(r *lottery.Request) error {
+	fields, err := readLine(dec.r)
+	if err != nil {
+		return err
+	}
+
+	if err := parseRequest(fields, r); err != nil {
+		return &encoding.MessageError{Err: err}
+	}
+	return nil
+}
+
+func parseRequest(fields [][]byte, r *lottery.Request) error {
+	if !bytes.EqualFold(fields[0], playB) {
+		return fmt.Errorf("unknown command '%s'", fields[0])
+	}
+	if len(fields) != 4 {
+		return errors.New("usage: PLAY <uuid> <fee> <a>:<b>")
+	}
+
+	id, err := uuid.ParseBytes(fields[1])
+	if err != nil {
+		return err
+	}
+	fee, err := strconv.ParseUint(string(fields[2]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid fee '%s'", fields[2])
+	}
+	guess, err := lottery.ParsePair(string(fields[3]))
+	if err != nil {
+		return err
+	}
+
+	*r = lottery.Request{UUID: id, Fee: fee, Guess: guess}
+	return nil
+}
+
+type ResponseEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+func NewResponseEncoder(w io.Writer) *ResponseEncoder {
+	return &ResponseEncoder{w: w}
+}
+
+func (enc *ResponseEncoder) Encode(r *lottery.Response) error {
+	data := enc.buf[:0]
+
+	switch r.Type {
+	case lottery.Win:
+		data = append(data, winB...)
+		data = append(data, ' ')
+		data = strconv.AppendUint(data, r.Jackpot, 10)
+	case lottery.NoWin:
+		data = append(data, noWinB...)
+	case lottery.Bonus:
+		data = append(data, bonusB...)
+	case lottery.Error:
+		msg := r.Message
+		if len(msg) > lottery.MaxMessageLen {
+			msg = msg[:lottery.MaxMessageLen]
+		}
+		data = append(data, errorB...)
+		data = append(data, ' ')
+		data = strconv.AppendUint(data, uint64(r.Code), 10)
+		data = append(data, ' ')
+		data = append(data, sanitize(msg)...)
+	default:
+		return fmt.Errorf("invalid value: '%d'", r.Type)
+	}
+	data = append(data, crlf...)
+	enc.buf = data
+
+	_, err := enc.w.Write(data)
+	return err
+}
+
+// sanitize replaces line breaks so that message fits into a single line
+func sanitize(msg string) []byte {
+	return bytes.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, []byte(msg))
+}
+
+type ResponseDecoder struct {
+	r *bufio.Reader
+}
+
+func NewResponseDecoder(r io.Reader) *ResponseDecoder {
+	return &ResponseDecoder{r: bufio.NewReaderSize(r, MaxLineSize)}
+}
+
+func (dec *ResponseDecoder) Decode(r *lottery.Response) error {
+	fields, err := readLine(dec.r)
+	if err != nil {
+		return err
+	}
+
+	if err := parseResponse(fields, r); err != nil {
+		return &encoding.MessageError{Err: err}
+	}
+	return nil
+}
+
+func parseResponse(fields [][]byte, r *lottery.Response) error {
+	cmd := fields[0]
+
+	switch {
+	case bytes.EqualFold(cmd, winB):
+		if len(fields) != 2 {
+			return errors.New("usage: WIN <jackpot>")
+		}
+		jackpot, err := strconv.ParseUint(string(fields[1]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid jackpot '%s'", fields[1])
+		}
+		*r = lottery.Response{Type: lottery.Win, Jackpot: jackpot}
+	case bytes.EqualFold(cmd, noWinB):
+		*r = lottery.Response{Type: lottery.NoWin}
+	case bytes.EqualFold(cmd, bonusB):
+		*r = lottery.Response{Type: lottery.Bonus}
+	case bytes.EqualFold(cmd, errorB):
+		if len(fields) < 2 {
+			return errors.New("usage: ERROR <code> <message>")
+		}
+		code, err := strconv.ParseUint(string(fields[1]), 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid error code '%s'", fields[1])
+		}
+		*r = lottery.Response{
+			Type:    lottery.Error,
+			Code:    lottery.ErrorCode(code),
+			Message: string(bytes.Join(fields[2:], []byte{' '})),
+		}
+	default:
+		return fmt.Errorf("unknown response '%s'", cmd)
+	}
+	return nil
+}
+
+func init() {
+	encoding.Register("line", Server{}, Client{})
+}
+
+type Server struct{}
+
+// Interactive marks the protocol as typed by hand, see encoding.Interactive
+func (Server) Interactive() {}
+
+func (Server) GetRequestDecoder(r io.Reader) encoding.RequestDecoder {
+	return NewRequestDecoder(r)
+}
+
+func (Server) GetResponseEncoder(w io.Writer) encoding.ResponseEncoder {
+	return NewResponseEncoder(w)
+}
+
+type Client struct{}
+
+func (Client) GetRequestEncoder(w io.Writer) encoding.RequestEncoder {
+	return NewRequestEncoder(w)
+}
+
+func (Client) GetResponseDecoder(r io.Reader) encoding.ResponseDecoder {
+	return NewResponseDecoder(r)
+}
@@ -0,0 +1,302 @@
+package line
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding"
+	"github.com/google/uuid"
+)
+
+func TestRequestEncoder_Encode(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	tests := []struct {
+		name string
+		r    *lottery.Request
+		buf  string
+	}{
+		{
+			name: "42",
+			r: &lottery.Request{
+				UUID:  id,
+				Fee:   42,
+				Guess: lottery.Pair{12, 200},
+			},
+			buf: "PLAY 550e8400-e29b-41d4-a716-446655440000 42 12:200\r\n",
+		},
+		{
+			name: "MaxUint64",
+			r: &lottery.Request{
+				UUID:  id,
+				Fee:   math.MaxUint64,
+				Guess: lottery.Pair{32, 10},
+			},
+			buf: "PLAY 550e8400-e29b-41d4-a716-446655440000 18446744073709551615 32:10\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			if err := NewRequestEncoder(w).Encode(tt.r); err != nil {
+				t.Errorf("RequestEncoder.Encode() error = %v", err)
+			} else if tt.buf != w.String() {
+				t.Errorf("RequestEncoder.Encode() {%q} != {%q}", tt.buf, w.String())
+			}
+		})
+	}
+}
+
+func TestResponseEncoder_Encode(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       *lottery.Response
+		wantErr bool
+		buf     string
+	}{
+		{
+			name: "win",
+			r: &lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: 1234,
+			},
+			buf: "WIN 1234\r\n",
+		},
+		{
+			name: "nowin",
+			r: &lottery.Response{
+				Type: lottery.NoWin,
+			},
+			buf: "NOWIN\r\n",
+		},
+		{
+			name: "bonus",
+			r: &lottery.Response{
+				Type:    lottery.Bonus,
+				Jackpot: 42,
+			},
+			buf: "BONUS\r\n",
+		},
+		{
+			name: "error",
+			r: &lottery.Response{
+				Type:    lottery.Error,
+				Code:    lottery.CodeBadRequest,
+				Message: "unknown command\r\n'FOO'",
+			},
+			buf: "ERROR 2 unknown command  'FOO'\r\n",
+		},
+		{
+			name: "wrong type",
+			r: &lottery.Response{
+				Type: lottery.ResponseType(42),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			if err := NewResponseEncoder(w).Encode(tt.r); (err != nil) != tt.wantErr {
+				t.Errorf("ResponseEncoder.Encode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.buf != w.String() {
+				t.Errorf("ResponseEncoder.Encode() {%q} != {%q}", tt.buf, w.String())
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_Decode(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	tests := []struct {
+		name        string
+		data        string
+		wantErr     bool
+		wantSkipped bool
+		res         lottery.Request
+	}{
+		{
+			name: "crlf",
+			data: "PLAY 550e8400-e29b-41d4-a716-446655440000 42 12:200\r\n",
+			res: lottery.Request{
+				UUID:  id,
+				Fee:   42,
+				Guess: lottery.Pair{12, 200},
+			},
+		},
+		{
+			name: "lf lowercase extra spaces",
+			data: "\r\n  play   550e8400-e29b-41d4-a716-446655440000\t42 12:200  \n",
+			res: lottery.Request{
+				UUID:  id,
+				Fee:   42,
+				Guess: lottery.Pair{12, 200},
+			},
+		},
+		{
+			name:        "unknown command",
+			data:        "HELLO\r\n",
+			wantErr:     true,
+			wantSkipped: true,
+		},
+		{
+			name:        "missing guess",
+			data:        "PLAY 550e8400-e29b-41d4-a716-446655440000 42\r\n",
+			wantErr:     true,
+			wantSkipped: true,
+		},
+		{
+			name:        "bad uuid",
+			data:        "PLAY 550e8400 42 12:200\r\n",
+			wantErr:     true,
+			wantSkipped: true,
+		},
+		{
+			name:        "bad fee",
+			data:        "PLAY 550e8400-e29b-41d4-a716-446655440000 -42 12:200\r\n",
+			wantErr:     true,
+			wantSkipped: true,
+		},
+		{
+			name:        "bad guess",
+			data:        "PLAY 550e8400-e29b-41d4-a716-446655440000 42 12;200\r\n",
+			wantErr:     true,
+			wantSkipped: true,
+		},
+		{
+			name:        "too long",
+			data:        "PLAY " + strings.Repeat("0", MaxLineSize) + "\r\n",
+			wantErr:     true,
+			wantSkipped: true,
+		},
+		{
+			name:    "no newline",
+			data:    "PLAY 550e8400-e29b-41d4-a716-446655440000 42 12:200",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r lottery.Request
+			err := NewRequestDecoder(strings.NewReader(tt.data)).Decode(&r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RequestDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.res != r {
+				t.Errorf("RequestDecoder.Decode() {%v} != {%v}", tt.res, r)
+			}
+			if _, ok := err.(*encoding.MessageError); ok != tt.wantSkipped {
+				t.Errorf("RequestDecoder.Decode() error = %v, wantSkipped %v", err, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_LongLine(t *testing.T) {
+	// Server passes a reader buffered beyond MaxLineSize
+	data := "PLAY " + strings.Repeat("0", MaxLineSize) + "\r\n" +
+		"PLAY 550e8400-e29b-41d4-a716-446655440000 42 12:200\r\n"
+	dec := NewRequestDecoder(bufio.NewReaderSize(strings.NewReader(data), 4096))
+
+	var r lottery.Request
+	if err := dec.Decode(&r); err == nil {
+		t.Fatalf("RequestDecoder.Decode() of long line succeeded")
+	} else if _, ok := err.(*encoding.MessageError); !ok {
+		t.Fatalf("RequestDecoder.Decode() error = %v, want *encoding.MessageError", err)
+	}
+	if err := dec.Decode(&r); err != nil {
+		t.Errorf("RequestDecoder.Decode() error = %v", err)
+	}
+}
+
+func TestResponseDecoder_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		res     lottery.Response
+	}{
+		{
+			name: "win",
+			data: "WIN 1234\r\n",
+			res: lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: 1234,
+			},
+		},
+		{
+			name: "nowin",
+			data: "nowin\n",
+			res: lottery.Response{
+				Type: lottery.NoWin,
+			},
+		},
+		{
+			name: "bonus",
+			data: "BONUS\r\n",
+			res: lottery.Response{
+				Type: lottery.Bonus,
+			},
+		},
+		{
+			name: "error",
+			data: "ERROR 2 unknown command 'FOO'\r\n",
+			res: lottery.Response{
+				Type:    lottery.Error,
+				Code:    lottery.CodeBadRequest,
+				Message: "unknown command 'FOO'",
+			},
+		},
+		{
+			name:    "win no jackpot",
+			data:    "WIN\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "error bad code",
+			data:    "ERROR 256 oops\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown",
+			data:    "WINWIN 42\r\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r lottery.Response
+			err := NewResponseDecoder(strings.NewReader(tt.data)).Decode(&r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResponseDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.res != r {
+				t.Errorf("ResponseDecoder.Decode() {%v} != {%v}", tt.res, r)
+			}
+		})
+	}
+}
+
+func TestRequestDecoder_Resync(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	data := "HELP\r\n" +
+		"PLAY " + strings.Repeat("x", 2*MaxLineSize) + "\r\n" +
+		"PLAY 550e8400-e29b-41d4-a716-446655440000 42 1:2\r\n"
+
+	dec := NewRequestDecoder(strings.NewReader(data))
+	for i := 0; i < 2; i++ {
+		var r lottery.Request
+		if _, ok := dec.Decode(&r).(*encoding.MessageError); !ok {
+			t.Fatalf("Decode() of bad line %d didn't skip it", i)
+		}
+	}
+
+	var r lottery.Request
+	if err := dec.Decode(&r); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if want := (lottery.Request{UUID: id, Fee: 42, Guess: lottery.Pair{1, 2}}); r != want {
+		t.Errorf("Decode() {%v} != {%v}", r, want)
+	}
+}
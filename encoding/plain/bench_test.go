@@ -0,0 +1,114 @@
+package plain
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/google/uuid"
+)
+
+// countingReader counts Read calls, which are syscalls on a net.Conn
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.n++
+	return r.r.Read(p)
+}
+
+// countingWriter counts Write calls, which are syscalls on a net.Conn
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n++
+	return len(p), nil
+}
+
+var benchRequest = lottery.Request{
+	UUID:  uuid.Must(uuid.Parse("550e8400-e29b-41d4-a716-446655440000")),
+	Fee:   150,
+	Guess: lottery.Pair{33, 35},
+}
+
+func BenchmarkRequestDecoder_Decode(b *testing.B) {
+	msg := []byte("550e8400-e29b-41d4-a716-446655440000 150 !#")
+	r := &countingReader{r: bytes.NewReader(bytes.Repeat(msg, b.N))}
+	dec := NewRequestDecoder(r)
+	req := lottery.Request{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dec.Decode(&req); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(r.n)/float64(b.N), "reads/op")
+}
+
+func BenchmarkRequestDecoderV2_Decode(b *testing.B) {
+	msg := []byte("550e8400-e29b-41d4-a716-446655440000 150 33:35 ")
+	r := &countingReader{r: bytes.NewReader(bytes.Repeat(msg, b.N))}
+	dec := NewRequestDecoderV2(r)
+	req := lottery.Request{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dec.Decode(&req); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(r.n)/float64(b.N), "reads/op")
+}
+
+func BenchmarkResponseDecoder_Decode(b *testing.B) {
+	msg := []byte("win 1234567 ")
+	r := &countingReader{r: bytes.NewReader(bytes.Repeat(msg, b.N))}
+	dec := NewResponseDecoder(r)
+	resp := lottery.Response{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dec.Decode(&resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(r.n)/float64(b.N), "reads/op")
+}
+
+func BenchmarkRequestEncoder_Encode(b *testing.B) {
+	w := &countingWriter{}
+	enc := NewRequestEncoder(w)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(&benchRequest); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(w.n)/float64(b.N), "writes/op")
+}
+
+func BenchmarkResponseEncoder_Encode(b *testing.B) {
+	w := &countingWriter{}
+	enc := NewResponseEncoder(w)
+	resp := lottery.Response{Type: lottery.Win, Jackpot: 18446744073709551615}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(&resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(w.n)/float64(b.N), "writes/op")
+}
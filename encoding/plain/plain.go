@@ -1,7 +1,9 @@
 package plain
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -9,78 +11,181 @@ import (
 
 	"github.com/bpiddubnyi/lottery"
 	"github.com/bpiddubnyi/lottery/encoding"
+	"github.com/google/uuid"
 	"go4.org/strutil"
 )
 
 const (
 	fieldSeparator byte = ' '
+
+	// len(UUID): 36
+	// len(MaxUInt64): 20
+	// len(Pair): 2
+	uuidLen   = 36
+	uint64Len = 20
+
+	// len("255:255")
+	pairLen = 7
+
+	// Size of the read buffer. It's small enough to be allocated per
+	// message, but still lets a decoder read a whole message at once
+	readBufferSize = 128
 )
 
+// Version is a plain request format version. Responses are the same in
+// all versions
+type Version int
+
+// Supported versions
+const (
+	// V1 sends guess as two raw bytes: "<uuid> <fee> <a><b>"
+	V1 Version = 1
+	// V2 sends guess as decimal pair, like lottery.Pair.String does:
+	// "<uuid> <fee> <a>:<b> ". Versions aren't told apart by the request
+	// format, V2 is registered as "plain2" codec to be picked by preamble
+	V2 Version = 2
+)
+
+// newReader returns r if it's already buffered, or wraps it otherwise
+func newReader(r io.Reader) *bufio.Reader {
+	return bufio.NewReaderSize(r, readBufferSize)
+}
+
 type RequestEncoder struct {
-	w io.Writer
+	w       io.Writer
+	buf     []byte
+	version Version
 }
 
 func NewRequestEncoder(w io.Writer) *RequestEncoder {
 	return &RequestEncoder{w: w}
 }
 
+func NewRequestEncoderV2(w io.Writer) *RequestEncoder {
+	return &RequestEncoder{w: w, version: V2}
+}
+
 func (enc *RequestEncoder) Encode(r *lottery.Request) error {
-	data, _ := r.UUID.MarshalText()
+	data := appendUUID(enc.buf[:0], r.UUID)
 	data = append(data, fieldSeparator)
 	data = strconv.AppendUint(data, r.Fee, 10)
 	data = append(data, fieldSeparator)
-	data = append(data, r.Guess[:]...)
+	if enc.version == V2 {
+		data = strconv.AppendUint(data, uint64(r.Guess[0]), 10)
+		data = append(data, ':')
+		data = strconv.AppendUint(data, uint64(r.Guess[1]), 10)
+		data = append(data, fieldSeparator)
+	} else {
+		data = append(data, r.Guess[:]...)
+	}
+	enc.buf = data
 
 	_, err := enc.w.Write(data)
 	return err
 }
 
+// appendUUID appends canonical textual representation of UUID to dst.
+// Unlike uuid.UUID.MarshalText it doesn't allocate
+func appendUUID(dst []byte, u uuid.UUID) []byte {
+	var buf [uuidLen]byte
+
+	hex.Encode(buf[:], u[:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+
+	return append(dst, buf[:]...)
+}
+
 type RequestDecoder struct {
-	r io.Reader
+	r       io.Reader
+	br      *bufio.Reader
+	buf     [uuidLen + 1]byte
+	version Version
 }
 
 func NewRequestDecoder(r io.Reader) *RequestDecoder {
-	return &RequestDecoder{r: r}
+	return &RequestDecoder{r: r, br: newReader(r)}
+}
+
+func NewRequestDecoderV2(r io.Reader) *RequestDecoder {
+	return &RequestDecoder{r: r, br: newReader(r), version: V2}
 }
 
 func (dec *RequestDecoder) Decode(r *lottery.Request) error {
-	// len(UUID): 36
-	// len(MaxUInt64): 20
-	// len(Pair): 2
-	// => max token len = 36 + 1 (separator)
-	buf := make([]byte, 37)
+	if dec.br == nil {
+		dec.br = newReader(dec.r)
+	}
 
 	// Read and parse UUID
-	_, err := io.ReadFull(dec.r, buf)
+	_, err := io.ReadFull(dec.br, dec.buf[:])
 	if err != nil {
 		return err
 	}
-	err = r.UUID.UnmarshalText(buf[:36])
+	err = r.UUID.UnmarshalText(dec.buf[:uuidLen])
 	if err != nil {
 		return err
 	}
 
 	// Read and parse fee
-	n, err := readUntil(dec.r, buf, fieldSeparator)
+	token, err := readToken(dec.br, uint64Len)
 	if err != nil {
 		return err
 	}
-	fee, err := strutil.ParseUintBytes(buf[:n], 10, 64)
+	fee, err := strutil.ParseUintBytes(token, 10, 64)
 	if err != nil {
 		return err
 	}
 	r.Fee = fee
 
 	// Read lucky pair
-	_, err = io.ReadFull(dec.r, r.Guess[:])
+	if dec.version == V2 {
+		token, err = readToken(dec.br, pairLen)
+		if err != nil {
+			return err
+		}
+		r.Guess, err = parsePair(token)
+		return err
+	}
+
+	_, err = io.ReadFull(dec.br, r.Guess[:])
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// parsePair is like lottery.ParsePair, but parses bytes without copying
+// them to a string
+func parsePair(data []byte) (lottery.Pair, error) {
+	var p lottery.Pair
+
+	i := bytes.IndexByte(data, ':')
+	if i < 0 {
+		return p, fmt.Errorf("invalid pair: '%s'", data)
+	}
+
+	a, err := strutil.ParseUintBytes(data[:i], 10, 8)
+	if err != nil {
+		return p, fmt.Errorf("invalid pair: '%s'", data)
+	}
+	b, err := strutil.ParseUintBytes(data[i+1:], 10, 8)
+	if err != nil {
+		return p, fmt.Errorf("invalid pair: '%s'", data)
+	}
+
+	p[0], p[1] = byte(a), byte(b)
+	return p, nil
+}
+
 type ResponseEncoder struct {
-	w io.Writer
+	w   io.Writer
+	buf []byte
 }
 
 func NewResponseEncoder(w io.Writer) *ResponseEncoder {
@@ -91,53 +196,61 @@ var (
 	noWinB = []byte("nowin")
 	winB   = []byte("win")
 	bonusB = []byte("bonus")
+	errorB = []byte("error")
 )
 
-func marshalResponseType(t lottery.ResponseType) ([]byte, error) {
-	var (
-		res = make([]byte, 5)
-		c   []byte
-	)
-
+func appendResponseType(dst []byte, t lottery.ResponseType) ([]byte, error) {
 	switch t {
 	case lottery.NoWin:
-		c = noWinB
+		return append(dst, noWinB...), nil
 	case lottery.Win:
-		c = winB
+		return append(dst, winB...), nil
 	case lottery.Bonus:
-		c = bonusB
+		return append(dst, bonusB...), nil
+	case lottery.Error:
+		return append(dst, errorB...), nil
 	default:
-		return nil, fmt.Errorf("invalid value: '%d'", t)
+		return dst, fmt.Errorf("invalid value: '%d'", t)
 	}
-
-	copy(res, c)
-	res = res[:len(c)]
-
-	return res, nil
 }
 
 func (enc *ResponseEncoder) Encode(r *lottery.Response) error {
-	data, err := marshalResponseType(r.Type)
+	data, err := appendResponseType(enc.buf[:0], r.Type)
 	if err != nil {
 		return err
 	}
 
 	data = append(data, fieldSeparator)
-	if r.Type == lottery.Win {
+	switch r.Type {
+	case lottery.Win:
 		data = strconv.AppendUint(data, r.Jackpot, 10)
 		data = append(data, fieldSeparator)
+	case lottery.Error:
+		// error <code> <message length> <message>
+		msg := r.Message
+		if len(msg) > lottery.MaxMessageLen {
+			msg = msg[:lottery.MaxMessageLen]
+		}
+		data = strconv.AppendUint(data, uint64(r.Code), 10)
+		data = append(data, fieldSeparator)
+		data = strconv.AppendUint(data, uint64(len(msg)), 10)
+		data = append(data, fieldSeparator)
+		data = append(data, msg...)
+		data = append(data, fieldSeparator)
 	}
+	enc.buf = data
 
 	_, err = enc.w.Write(data)
 	return err
 }
 
 type ResponseDecoder struct {
-	r io.Reader
+	r  io.Reader
+	br *bufio.Reader
 }
 
 func NewResponseDecoder(r io.Reader) *ResponseDecoder {
-	return &ResponseDecoder{r: r}
+	return &ResponseDecoder{r: r, br: newReader(r)}
 }
 
 func unmarshalResponseType(data []byte) (lottery.ResponseType, error) {
@@ -151,56 +264,110 @@ func unmarshalResponseType(data []byte) (lottery.ResponseType, error) {
 		return lottery.Win, nil
 	} else if bytes.Equal(data, bonusB) {
 		return lottery.Bonus, nil
+	} else if bytes.Equal(data, errorB) {
+		return lottery.Error, nil
 	} else {
 		return lottery.NoWin, fmt.Errorf("invalid string: '%s'", data)
 	}
 }
 
 func (dec *ResponseDecoder) Decode(r *lottery.Response) error {
-	buf := make([]byte, 20)
-	n, err := readUntil(dec.r, buf, fieldSeparator)
+	if dec.br == nil {
+		dec.br = newReader(dec.r)
+	}
+
+	token, err := readToken(dec.br, uint64Len)
 	if err != nil {
 		return err
 	}
 
-	r.Type, err = unmarshalResponseType(buf[:n])
+	r.Type, err = unmarshalResponseType(token)
 	if err != nil {
 		return fmt.Errorf("failed to parse response type: %s", err)
 	}
-	if r.Type != lottery.Win {
+	r.Jackpot, r.Code, r.Message = 0, lottery.CodeUnknown, ""
+
+	switch r.Type {
+	case lottery.Win:
+		token, err = readToken(dec.br, uint64Len)
+		if err != nil {
+			return err
+		}
+
+		r.Jackpot, err = strutil.ParseUintBytes(token, 10, 64)
+		return err
+	case lottery.Error:
+		return dec.decodeError(r)
+	default:
 		return nil
 	}
+}
 
-	n, err = readUntil(dec.r, buf, fieldSeparator)
+func (dec *ResponseDecoder) decodeError(r *lottery.Response) error {
+	token, err := readToken(dec.br, 3)
 	if err != nil {
 		return err
 	}
+	code, err := strutil.ParseUintBytes(token, 10, 8)
+	if err != nil {
+		return fmt.Errorf("failed to parse error code: %s", err)
+	}
 
-	r.Jackpot, err = strutil.ParseUintBytes(buf[:n], 10, 64)
-	return err
+	token, err = readToken(dec.br, 3)
+	if err != nil {
+		return err
+	}
+	n, err := strutil.ParseUintBytes(token, 10, 8)
+	if err != nil {
+		return fmt.Errorf("failed to parse error message length: %s", err)
+	}
+
+	// Message is followed by the field separator
+	msg := make([]byte, n+1)
+	if _, err := io.ReadFull(dec.br, msg); err != nil {
+		return err
+	}
+	if msg[n] != fieldSeparator {
+		return errNoDelimFound
+	}
+
+	r.Code = lottery.ErrorCode(code)
+	r.Message = string(msg[:n])
+	return nil
 }
 
 var (
 	errNoDelimFound = errors.New("no delimiter found")
 )
 
-func readUntil(r io.Reader, buf []byte, delim byte) (int, error) {
-	for i := range buf {
-		_, err := r.Read(buf[i : i+1])
-
-		if buf[i] == delim {
-			return i, nil
-		}
-		if err != nil {
-			return i, err
-		}
+// readToken reads up to maxLen bytes followed by the field separator and
+// returns them without the separator. The returned slice is only valid until
+// the next read
+func readToken(r *bufio.Reader, maxLen int) ([]byte, error) {
+	token, err := r.ReadSlice(fieldSeparator)
+	if err == bufio.ErrBufferFull || len(token) > maxLen+1 {
+		return nil, errNoDelimFound
 	}
-	return 0, errNoDelimFound
+	if err != nil {
+		return nil, err
+	}
+	return token[:len(token)-1], nil
+}
+
+func init() {
+	encoding.Register("plain", Server{}, Client{})
+	encoding.Register("plain2", Server{Version: V2}, Client{Version: V2})
 }
 
-type Server struct{}
+// Server is a server-side plain codec. Zero value uses V1 format
+type Server struct {
+	Version Version
+}
 
-func (Server) GetRequestDecoder(r io.Reader) encoding.RequestDecoder {
+func (s Server) GetRequestDecoder(r io.Reader) encoding.RequestDecoder {
+	if s.Version == V2 {
+		return NewRequestDecoderV2(r)
+	}
 	return NewRequestDecoder(r)
 }
 
@@ -208,9 +375,15 @@ func (Server) GetResponseEncoder(w io.Writer) encoding.ResponseEncoder {
 	return NewResponseEncoder(w)
 }
 
-type Client struct{}
+// Client is a client-side plain codec. Zero value uses V1 format
+type Client struct {
+	Version Version
+}
 
-func (Client) GetRequestEncoder(w io.Writer) encoding.RequestEncoder {
+func (c Client) GetRequestEncoder(w io.Writer) encoding.RequestEncoder {
+	if c.Version == V2 {
+		return NewRequestEncoderV2(w)
+	}
 	return NewRequestEncoder(w)
 }
 
@@ -155,6 +155,35 @@ func TestResponseEncoder_Encode(t *testing.T) {
 			wantErr: false,
 			buf:     []byte("win 18446744073709551615 "),
 		},
+		{
+			name: "error",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Response{
+					Type:    lottery.Error,
+					Code:    lottery.CodeBadRequest,
+					Message: "bad fee",
+				},
+			},
+			wantErr: false,
+			buf:     []byte("error 2 7 bad fee "),
+		},
+		{
+			name: "error no message",
+			fields: fields{
+				w: &bytes.Buffer{},
+			},
+			args: args{
+				r: &lottery.Response{
+					Type: lottery.Error,
+					Code: lottery.CodeInternal,
+				},
+			},
+			wantErr: false,
+			buf:     []byte("error 1 0  "),
+		},
 		{
 			name: "wrong type",
 			fields: fields{
@@ -360,6 +389,89 @@ func TestResponseDecoder_Decode(t *testing.T) {
 				Jackpot: 0,
 			},
 		},
+		{
+			name: "MaxUint64",
+			fields: fields{
+				r: bytes.NewReader([]byte("win 18446744073709551615 ")),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Win,
+				Jackpot: math.MaxUint64,
+			},
+		},
+		{
+			name: "too long jackpot",
+			fields: fields{
+				r: bytes.NewReader([]byte("win 184467440737095516150 ")),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "error",
+			fields: fields{
+				r: bytes.NewReader([]byte("error 2 7 bad fee ")),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: false,
+			res: lottery.Response{
+				Type:    lottery.Error,
+				Code:    lottery.CodeBadRequest,
+				Message: "bad fee",
+			},
+		},
+		{
+			name: "error no message",
+			fields: fields{
+				r: bytes.NewReader([]byte("error 1 0  ")),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: false,
+			res: lottery.Response{
+				Type: lottery.Error,
+				Code: lottery.CodeInternal,
+			},
+		},
+		{
+			name: "error short message",
+			fields: fields{
+				r: bytes.NewReader([]byte("error 2 7 bad ")),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "error bad length",
+			fields: fields{
+				r: bytes.NewReader([]byte("error 2 256 bad fee ")),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "error bad code",
+			fields: fields{
+				r: bytes.NewReader([]byte("error x 7 bad fee ")),
+			},
+			args: args{
+				r: &lottery.Response{},
+			},
+			wantErr: true,
+		},
 		{
 			name: "win_short_jackpot",
 			fields: fields{
@@ -424,3 +536,150 @@ func TestResponseDecoder_Decode(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestDecoder_DecodeStream(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	reqs := []lottery.Request{
+		{UUID: id, Fee: 150, Guess: lottery.Pair{33, 35}},
+		{UUID: id, Fee: math.MaxUint64, Guess: lottery.Pair{' ', ' '}},
+		{UUID: id, Fee: 0, Guess: lottery.Pair{0, 255}},
+	}
+
+	var buf bytes.Buffer
+	enc := NewRequestEncoder(&buf)
+	for i := range reqs {
+		if err := enc.Encode(&reqs[i]); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+	}
+
+	dec := NewRequestDecoder(&buf)
+	for _, want := range reqs {
+		var got lottery.Request
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Decode() {%v} != {%v}", got, want)
+		}
+	}
+}
+
+func TestRequestEncoderV2_Encode(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	tests := []struct {
+		name string
+		r    *lottery.Request
+		buf  []byte
+	}{
+		{
+			name: "separator guess",
+			r: &lottery.Request{
+				UUID:  id,
+				Fee:   42,
+				Guess: lottery.Pair{32, 10},
+			},
+			buf: []byte("550e8400-e29b-41d4-a716-446655440000 42 32:10 "),
+		},
+		{
+			name: "MaxUint64",
+			r: &lottery.Request{
+				UUID:  id,
+				Fee:   math.MaxUint64,
+				Guess: lottery.Pair{255, 255},
+			},
+			buf: []byte("550e8400-e29b-41d4-a716-446655440000 18446744073709551615 255:255 "),
+		},
+		{
+			name: "zero",
+			r: &lottery.Request{
+				UUID:  id,
+				Fee:   0,
+				Guess: lottery.Pair{0, 0},
+			},
+			buf: []byte("550e8400-e29b-41d4-a716-446655440000 0 0:0 "),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			if err := NewRequestEncoderV2(w).Encode(tt.r); err != nil {
+				t.Errorf("RequestEncoder.Encode() error = %v", err)
+			} else if !bytes.Equal(tt.buf, w.Bytes()) {
+				t.Errorf("RequestEncoder.Encode() {%s} != {%s}", string(tt.buf), w.String())
+			}
+		})
+	}
+}
+
+func TestRequestDecoderV2_Decode(t *testing.T) {
+	id, _ := uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+		res     lottery.Request
+	}{
+		{
+			name:    "separator guess",
+			data:    "550e8400-e29b-41d4-a716-446655440000 42 32:10 ",
+			wantErr: false,
+			res: lottery.Request{
+				UUID:  id,
+				Fee:   42,
+				Guess: lottery.Pair{32, 10},
+			},
+		},
+		{
+			name:    "MaxUint64",
+			data:    "550e8400-e29b-41d4-a716-446655440000 18446744073709551615 255:255 ",
+			wantErr: false,
+			res: lottery.Request{
+				UUID:  id,
+				Fee:   math.MaxUint64,
+				Guess: lottery.Pair{255, 255},
+			},
+		},
+		{
+			name:    "v1 guess",
+			data:    "550e8400-e29b-41d4-a716-446655440000 42 !#",
+			wantErr: true,
+		},
+		{
+			name:    "guess out of range",
+			data:    "550e8400-e29b-41d4-a716-446655440000 42 256:1 ",
+			wantErr: true,
+		},
+		{
+			name:    "guess too long",
+			data:    "550e8400-e29b-41d4-a716-446655440000 42 0001:0001 ",
+			wantErr: true,
+		},
+		{
+			name:    "no separator",
+			data:    "550e8400-e29b-41d4-a716-446655440000 42 1:2",
+			wantErr: true,
+		},
+		{
+			name:    "no colon",
+			data:    "550e8400-e29b-41d4-a716-446655440000 42 12 ",
+			wantErr: true,
+		},
+		{
+			name:    "empty half",
+			data:    "550e8400-e29b-41d4-a716-446655440000 42 :12 ",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r lottery.Request
+			dec := NewRequestDecoderV2(bytes.NewReader([]byte(tt.data)))
+			if err := dec.Decode(&r); (err != nil) != tt.wantErr {
+				t.Errorf("RequestDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && tt.res != r {
+				t.Errorf("RequestDecoder.Decode() {%v} != {%v}", tt.res, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Connection preamble is an optional header a client sends before the first
+// request to choose the codec used for the rest of the connection:
+//
+//	magic   [4]byte  "LTRY"
+//	version uint8    protocol version, see PreambleVersion
+//	nameLen uint8    length of codec name
+//	name    []byte   registered codec name
+//
+// Connections without the preamble use the server default codec.
+
+// PreambleVersion is the only preamble version supported
+const PreambleVersion = 1
+
+var (
+	preambleMagic = []byte("LTRY")
+
+	// ErrNoPreamble is returned by ReadPreamble when the stream doesn't start
+	// with the preamble magic
+	ErrNoPreamble = errors.New("no preamble")
+)
+
+// UnsupportedVersionError is returned by ReadPreamble when peer uses
+// unsupported protocol version
+type UnsupportedVersionError struct {
+	Version byte
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported protocol version %d, only version %d is supported",
+		e.Version, PreambleVersion)
+}
+
+// WritePreamble writes connection preamble announcing the codec name
+func WritePreamble(w io.Writer, name string) error {
+	if len(name) == 0 || len(name) > 255 {
+		return fmt.Errorf("invalid codec name \"%s\"", name)
+	}
+
+	data := make([]byte, 0, len(preambleMagic)+2+len(name))
+	data = append(data, preambleMagic...)
+	data = append(data, PreambleVersion, byte(len(name)))
+	data = append(data, name...)
+
+	_, err := w.Write(data)
+	return err
+}
+
+// ReadPreamble reads connection preamble and returns the announced codec name.
+// If the stream doesn't start with the preamble magic ErrNoPreamble is
+// returned and nothing is consumed from r
+func ReadPreamble(r *bufio.Reader) (string, error) {
+	magic, err := r.Peek(len(preambleMagic))
+	if !bytes.HasPrefix(preambleMagic, magic) {
+		return "", ErrNoPreamble
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.Discard(len(magic)); err != nil {
+		return "", err
+	}
+
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", err
+	}
+	if hdr[0] != PreambleVersion {
+		return "", &UnsupportedVersionError{Version: hdr[0]}
+	}
+
+	name := make([]byte, hdr[1])
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", err
+	}
+	return string(name), nil
+}
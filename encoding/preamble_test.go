@@ -0,0 +1,92 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadPreamble(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr error
+		rest    []byte
+	}{
+		{
+			name: "jsonl",
+			data: []byte("LTRY\x01\x05jsonl{}\n"),
+			want: "jsonl",
+			rest: []byte("{}\n"),
+		},
+		{
+			name:    "no preamble",
+			data:    []byte("550e8400-e29b-41d4-a716-446655440000 42 !#"),
+			wantErr: ErrNoPreamble,
+			rest:    []byte("550e8400-e29b-41d4-a716-446655440000 42 !#"),
+		},
+		{
+			name:    "short no preamble",
+			data:    []byte("55"),
+			wantErr: ErrNoPreamble,
+			rest:    []byte("55"),
+		},
+		{
+			name:    "short magic",
+			data:    []byte("LT"),
+			wantErr: io.EOF,
+		},
+		{
+			name:    "short name",
+			data:    []byte("LTRY\x01\x05jso"),
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewReader(tt.data))
+			got, err := ReadPreamble(r)
+			if err != tt.wantErr {
+				t.Fatalf("ReadPreamble() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadPreamble() = %s, want %s", got, tt.want)
+			}
+			if tt.rest != nil {
+				rest, _ := io.ReadAll(r)
+				if !bytes.Equal(rest, tt.rest) {
+					t.Errorf("ReadPreamble() left {%s}, want {%s}", rest, tt.rest)
+				}
+			}
+		})
+	}
+}
+
+func TestReadPreamble_UnsupportedVersion(t *testing.T) {
+	r := bufio.NewReader(bytes.NewReader([]byte("LTRY\x02\x05jsonl")))
+	_, err := ReadPreamble(r)
+	if e, ok := err.(*UnsupportedVersionError); !ok || e.Version != 2 {
+		t.Errorf("ReadPreamble() error = %v, want unsupported version 2", err)
+	}
+}
+
+func TestWritePreamble(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePreamble(&buf, "binary"); err != nil {
+		t.Fatalf("WritePreamble() error = %v", err)
+	}
+
+	name, err := ReadPreamble(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("ReadPreamble() error = %v", err)
+	}
+	if name != "binary" {
+		t.Errorf("ReadPreamble() = %s, want binary", name)
+	}
+
+	if err := WritePreamble(&buf, ""); err == nil {
+		t.Errorf("WritePreamble() with empty name succeeded")
+	}
+}
@@ -0,0 +1,60 @@
+package encoding
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Codec is a named pair of server and client protocol implementations
+type Codec struct {
+	Name   string
+	Server Server
+	Client Client
+}
+
+var (
+	codecsL sync.RWMutex
+	codecs  = make(map[string]Codec)
+)
+
+// Register makes a codec available by the provided name. It is intended to be
+// called from the init function of codec packages. If Register is called twice
+// with the same name or if server or client is nil, it panics
+func Register(name string, s Server, c Client) {
+	codecsL.Lock()
+	defer codecsL.Unlock()
+
+	if s == nil || c == nil {
+		panic("encoding: Register codec is nil")
+	}
+	if _, dup := codecs[name]; dup {
+		panic("encoding: Register called twice for codec " + name)
+	}
+	codecs[name] = Codec{Name: name, Server: s, Client: c}
+}
+
+// Lookup returns a codec registered under the provided name
+func Lookup(name string) (Codec, error) {
+	codecsL.RLock()
+	defer codecsL.RUnlock()
+
+	c, ok := codecs[name]
+	if !ok {
+		return Codec{}, fmt.Errorf("unknown codec \"%s\"", name)
+	}
+	return c, nil
+}
+
+// Names returns a sorted list of registered codec names
+func Names() []string {
+	codecsL.RLock()
+	defer codecsL.RUnlock()
+
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
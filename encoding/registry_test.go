@@ -0,0 +1,42 @@
+package encoding
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+type nopCodec struct{}
+
+func (nopCodec) GetRequestDecoder(r io.Reader) RequestDecoder   { return nil }
+func (nopCodec) GetResponseEncoder(w io.Writer) ResponseEncoder { return nil }
+func (nopCodec) GetRequestEncoder(w io.Writer) RequestEncoder   { return nil }
+func (nopCodec) GetResponseDecoder(r io.Reader) ResponseDecoder { return nil }
+
+func TestRegister(t *testing.T) {
+	Register("test-b", nopCodec{}, nopCodec{})
+	Register("test-a", nopCodec{}, nopCodec{})
+
+	c, err := Lookup("test-a")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if c.Name != "test-a" {
+		t.Errorf("Lookup() name = %s, want test-a", c.Name)
+	}
+
+	if _, err := Lookup("test-c"); err == nil {
+		t.Errorf("Lookup() of unknown codec succeeded")
+	}
+
+	if got, want := Names(), []string{"test-a", "test-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() twice didn't panic")
+		}
+	}()
+	Register("test-a", nopCodec{}, nopCodec{})
+}
@@ -0,0 +1,55 @@
+package signed
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKeys(t *testing.T) {
+	priv, err := x509.MarshalPKCS8PrivateKey(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(testKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := LoadPrivateKey(writePEM(t, "PRIVATE KEY", priv))
+	if err != nil {
+		t.Fatalf("LoadPrivateKey() error = %v", err)
+	}
+	if !key.Equal(testKey) {
+		t.Errorf("LoadPrivateKey() returned another key")
+	}
+
+	pubKey, err := LoadPublicKey(writePEM(t, "PUBLIC KEY", pub))
+	if err != nil {
+		t.Fatalf("LoadPublicKey() error = %v", err)
+	}
+	if !pubKey.Equal(testKey.Public().(ed25519.PublicKey)) {
+		t.Errorf("LoadPublicKey() returned another key")
+	}
+
+	if _, err := LoadPrivateKey(writePEM(t, "PUBLIC KEY", pub)); err == nil {
+		t.Errorf("LoadPrivateKey() of public key succeeded")
+	}
+	if _, err := LoadPublicKey(writePEM(t, "PRIVATE KEY", priv)); err == nil {
+		t.Errorf("LoadPublicKey() of private key succeeded")
+	}
+}
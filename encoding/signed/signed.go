@@ -0,0 +1,229 @@
+// Package signed implements a decorator which signs responses of the wrapped
+// codec with Ed25519, so players get a receipt of every outcome. Every response
+// is followed by a trailer:
+//
+//	uuid      [16]byte  UUID of the request the response is sent for
+//	draw      [2]byte   winning pair drawn for the request
+//	commit    [32]byte  server seed commitment of a provably fair draw, zero otherwise
+//	nonce     uint64    nonce of a provably fair draw, big endian
+//	signature [64]byte  Ed25519 signature of the receipt
+//
+// Signature covers the request UUID, response type, jackpot, error code, the
+// winning pair, commitment and nonce, see Receipt. Requests are passed through
+// unchanged.
+package signed
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding"
+	"github.com/google/uuid"
+)
+
+const (
+	// Signed messages are prefixed with the context string, so the key
+	// can't be abused to sign anything but receipts
+	sigContext = "lottery response v2"
+
+	// uuid, type, jackpot, code, draw, commit, nonce
+	receiptLen = 16 + 1 + 8 + 1 + 2 + lottery.CommitLen + 8
+	trailerLen = 16 + 2 + lottery.CommitLen + 8 + ed25519.SignatureSize
+)
+
+var (
+	errInvalidSignature = errors.New("invalid response signature")
+	errNoRequestUUID    = errors.New("response is not bound to a request")
+)
+
+// Receipt is a signed server response. Players keep it as a proof of
+// the outcome
+type Receipt struct {
+	UUID      uuid.UUID
+	Type      lottery.ResponseType
+	Jackpot   uint64
+	Code      lottery.ErrorCode
+	Draw      lottery.Pair
+	Commit    [lottery.CommitLen]byte
+	Nonce     uint64
+	Signature [ed25519.SignatureSize]byte
+}
+
+func newReceipt(r *lottery.Response) *Receipt {
+	return &Receipt{
+		UUID:    r.UUID,
+		Type:    r.Type,
+		Jackpot: r.Jackpot,
+		Code:    r.Code,
+		Draw:    r.Draw,
+		Commit:  r.Commit,
+		Nonce:   r.Nonce,
+	}
+}
+
+func (rc *Receipt) marshal() []byte {
+	data := make([]byte, 0, receiptLen)
+	data = append(data, rc.UUID[:]...)
+	data = append(data, byte(rc.Type))
+	data = appendUint64(data, rc.Jackpot)
+	data = append(data, byte(rc.Code))
+	data = append(data, rc.Draw[:]...)
+	data = append(data, rc.Commit[:]...)
+	return appendUint64(data, rc.Nonce)
+}
+
+func (rc *Receipt) message() []byte {
+	return append([]byte(sigContext), rc.marshal()...)
+}
+
+func (rc *Receipt) sign(key ed25519.PrivateKey) {
+	copy(rc.Signature[:], ed25519.Sign(key, rc.message()))
+}
+
+// Verify reports whether the receipt is signed with the private key of pub
+func (rc *Receipt) Verify(pub ed25519.PublicKey) bool {
+	return ed25519.Verify(pub, rc.message(), rc.Signature[:])
+}
+
+// String returns hex encoded receipt followed by its signature
+func (rc *Receipt) String() string {
+	return hex.EncodeToString(append(rc.marshal(), rc.Signature[:]...))
+}
+
+func appendUint64(dst []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(dst, buf[:]...)
+}
+
+type ResponseEncoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+	enc encoding.ResponseEncoder
+	key ed25519.PrivateKey
+}
+
+func NewResponseEncoder(w io.Writer, proto encoding.Server, key ed25519.PrivateKey) *ResponseEncoder {
+	enc := &ResponseEncoder{w: w, key: key}
+	enc.enc = proto.GetResponseEncoder(&enc.buf)
+	return enc
+}
+
+func (enc *ResponseEncoder) Encode(r *lottery.Response) error {
+	defer enc.buf.Reset()
+
+	if err := enc.enc.Encode(r); err != nil {
+		return err
+	}
+
+	rc := newReceipt(r)
+	rc.sign(enc.key)
+
+	data := append(enc.buf.Bytes(), r.UUID[:]...)
+	data = append(data, r.Draw[:]...)
+	data = append(data, r.Commit[:]...)
+	data = appendUint64(data, r.Nonce)
+	data = append(data, rc.Signature[:]...)
+	_, err := enc.w.Write(data)
+	return err
+}
+
+type ResponseDecoder struct {
+	r         *bufio.Reader
+	dec       encoding.ResponseDecoder
+	key       ed25519.PublicKey
+	onReceipt func(*Receipt)
+	buf       [trailerLen]byte
+}
+
+func NewResponseDecoder(r io.Reader, proto encoding.Client, key ed25519.PublicKey) *ResponseDecoder {
+	// Wrapped decoder gets the same buffered reader, so the trailer can't get
+	// stuck in its buffer
+	br := bufio.NewReader(r)
+	return &ResponseDecoder{
+		r:   br,
+		dec: proto.GetResponseDecoder(br),
+		key: key,
+	}
+}
+
+// Decode decodes response and verifies its signature. Responses other than
+// Error must be bound to a request UUID, which callers should compare with
+// the one they've sent
+func (dec *ResponseDecoder) Decode(r *lottery.Response) error {
+	if err := dec.dec.Decode(r); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(dec.r, dec.buf[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	trailer := dec.buf[:]
+	copy(r.UUID[:], trailer[:16])
+	copy(r.Draw[:], trailer[16:18])
+	copy(r.Commit[:], trailer[18:18+lottery.CommitLen])
+	r.Nonce = binary.BigEndian.Uint64(trailer[18+lottery.CommitLen:])
+
+	rc := newReceipt(r)
+	copy(rc.Signature[:], trailer[trailerLen-ed25519.SignatureSize:])
+	if !rc.Verify(dec.key) {
+		return errInvalidSignature
+	}
+	if r.Type != lottery.Error && r.UUID == uuid.Nil {
+		return errNoRequestUUID
+	}
+
+	if dec.onReceipt != nil {
+		dec.onReceipt(rc)
+	}
+	return nil
+}
+
+// Server signs responses of the wrapped server-side codec
+type Server struct {
+	Proto encoding.Server
+	Key   ed25519.PrivateKey
+}
+
+func NewServer(proto encoding.Server, key ed25519.PrivateKey) *Server {
+	return &Server{Proto: proto, Key: key}
+}
+
+func (s *Server) GetRequestDecoder(r io.Reader) encoding.RequestDecoder {
+	return s.Proto.GetRequestDecoder(r)
+}
+
+func (s *Server) GetResponseEncoder(w io.Writer) encoding.ResponseEncoder {
+	return NewResponseEncoder(w, s.Proto, s.Key)
+}
+
+// Client verifies responses of the wrapped client-side codec
+type Client struct {
+	Proto encoding.Client
+	Key   ed25519.PublicKey
+	// Optional callback receiving every verified receipt
+	OnReceipt func(*Receipt)
+}
+
+func NewClient(proto encoding.Client, key ed25519.PublicKey) *Client {
+	return &Client{Proto: proto, Key: key}
+}
+
+func (c *Client) GetRequestEncoder(w io.Writer) encoding.RequestEncoder {
+	return c.Proto.GetRequestEncoder(w)
+}
+
+func (c *Client) GetResponseDecoder(r io.Reader) encoding.ResponseDecoder {
+	dec := NewResponseDecoder(r, c.Proto, c.Key)
+	dec.onReceipt = c.OnReceipt
+	return dec
+}
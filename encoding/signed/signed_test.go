@@ -0,0 +1,144 @@
+package signed
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+	"github.com/bpiddubnyi/lottery/encoding/plain"
+	"github.com/google/uuid"
+)
+
+var (
+	testUUID, _ = uuid.Parse("550e8400-e29b-41d4-a716-446655440000")
+	testKey     = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	otherKey    = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))
+)
+
+func encode(t *testing.T, key ed25519.PrivateKey, r lottery.Response) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := NewResponseEncoder(&buf, plain.Server{}, key).Encode(&r); err != nil {
+		t.Fatalf("ResponseEncoder.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// tamper returns a copy of data with the byte at offset i from the end flipped
+func tamper(data []byte, i int) []byte {
+	data = append([]byte(nil), data...)
+	data[len(data)+i] ^= 0xff
+	return data
+}
+
+func TestResponseDecoder_Decode(t *testing.T) {
+	win := lottery.Response{Type: lottery.Win, Jackpot: 100, UUID: testUUID, Draw: lottery.Pair{1, 2}}
+	signed := encode(t, testKey, win)
+	fairWin := win
+	fairWin.Commit[0], fairWin.Nonce = 0xab, 7
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    lottery.Response
+		wantErr bool
+	}{
+		{
+			name: "win",
+			data: signed,
+			want: win,
+		},
+		{
+			name: "nowin",
+			data: encode(t, testKey, lottery.Response{Type: lottery.NoWin, UUID: testUUID, Draw: lottery.Pair{3, 4}}),
+			want: lottery.Response{Type: lottery.NoWin, UUID: testUUID, Draw: lottery.Pair{3, 4}},
+		},
+		{
+			name: "fair",
+			data: encode(t, testKey, fairWin),
+			want: fairWin,
+		},
+		{
+			name:    "tampered nonce",
+			data:    tamper(encode(t, testKey, fairWin), -ed25519.SignatureSize-1),
+			wantErr: true,
+		},
+		{
+			name: "error without request",
+			data: encode(t, testKey, lottery.Response{Type: lottery.Error, Code: lottery.CodeBadRequest, Message: "bad"}),
+			want: lottery.Response{Type: lottery.Error, Code: lottery.CodeBadRequest, Message: "bad"},
+		},
+		{
+			name:    "nowin without request",
+			data:    encode(t, testKey, lottery.Response{Type: lottery.NoWin}),
+			wantErr: true,
+		},
+		{
+			name:    "tampered jackpot",
+			data:    bytes.Replace(signed, []byte("win 100 "), []byte("win 900 "), 1),
+			wantErr: true,
+		},
+		{
+			name:    "tampered draw",
+			data:    tamper(signed, -ed25519.SignatureSize-lottery.CommitLen-8-1),
+			wantErr: true,
+		},
+		{
+			name:    "wrong key",
+			data:    encode(t, otherKey, win),
+			wantErr: true,
+		},
+		{
+			name:    "unsigned",
+			data:    []byte("win 100 "),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got lottery.Response
+				rc  *Receipt
+			)
+			c := NewClient(plain.Client{}, testKey.Public().(ed25519.PublicKey))
+			c.OnReceipt = func(r *Receipt) { rc = r }
+
+			err := c.GetResponseDecoder(bytes.NewReader(tt.data)).Decode(&got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResponseDecoder.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if rc != nil {
+					t.Errorf("ResponseDecoder.Decode() receipt reported on error")
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ResponseDecoder.Decode() {%v} != {%v}", got, tt.want)
+			}
+			if rc == nil || rc.UUID != tt.want.UUID || rc.Draw != tt.want.Draw ||
+				rc.Commit != tt.want.Commit || rc.Nonce != tt.want.Nonce {
+				t.Errorf("ResponseDecoder.Decode() receipt = %v", rc)
+			}
+		})
+	}
+}
+
+func TestResponseDecoder_Stream(t *testing.T) {
+	bonus := lottery.Response{Type: lottery.Bonus, UUID: testUUID, Draw: lottery.Pair{5, 5}}
+	win := lottery.Response{Type: lottery.Win, Jackpot: 42, UUID: testUUID, Draw: lottery.Pair{6, 7}}
+	data := append(encode(t, testKey, bonus), encode(t, testKey, win)...)
+
+	dec := NewResponseDecoder(bytes.NewReader(data), plain.Client{}, testKey.Public().(ed25519.PublicKey))
+	for _, want := range []lottery.Response{bonus, win} {
+		var got lottery.Response
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("ResponseDecoder.Decode() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("ResponseDecoder.Decode() {%v} != {%v}", got, want)
+		}
+	}
+}
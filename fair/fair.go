@@ -0,0 +1,60 @@
+// Package fair implements provably fair commit-reveal lucky pair draws.
+//
+// The server picks a random seed and publishes its commitment, SHA-256 hash of
+// the seed, before any draw is made. Every pair is derived from the server seed,
+// a client seed chosen by the player and a nonce:
+//
+//	pair = HMAC-SHA256(serverSeed, clientSeed || nonce)[:2]
+//
+// where nonce is a big endian uint64 counting draws made with the server seed.
+// Once the seed is revealed anyone can check it matches the commitment and
+// recompute past draws with Draw.
+package fair
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+// SeedSize is the size of server seeds generated by NewSeed
+const SeedSize = 32
+
+// NewSeed generates a random server seed
+func NewSeed() ([]byte, error) {
+	seed := make([]byte, SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+// Commit returns commitment of the server seed
+func Commit(seed []byte) []byte {
+	sum := sha256.Sum256(seed)
+	return sum[:]
+}
+
+// Verify reports whether the server seed matches the commitment
+func Verify(seed, commit []byte) bool {
+	return hmac.Equal(Commit(seed), commit)
+}
+
+// Draw derives lucky pair from the server seed, client seed and nonce
+func Draw(serverSeed, clientSeed []byte, nonce uint64) lottery.Pair {
+	var (
+		p   lottery.Pair
+		buf [8]byte
+	)
+
+	h := hmac.New(sha256.New, serverSeed)
+	h.Write(clientSeed)
+	binary.BigEndian.PutUint64(buf[:], nonce)
+	h.Write(buf[:])
+
+	copy(p[:], h.Sum(nil))
+	return p
+}
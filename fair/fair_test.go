@@ -0,0 +1,75 @@
+package fair
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/bpiddubnyi/lottery"
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestDraw(t *testing.T) {
+	seed := bytes.Repeat([]byte{1}, SeedSize)
+	client := mustHex("550e8400e29b41d4a716446655440000")
+
+	tests := []struct {
+		name       string
+		serverSeed []byte
+		clientSeed []byte
+		nonce      uint64
+		want       lottery.Pair
+	}{
+		{
+			name:       "first",
+			serverSeed: seed,
+			clientSeed: client,
+			nonce:      0,
+			want:       lottery.Pair{0, 163},
+		},
+		{
+			name:       "second",
+			serverSeed: seed,
+			clientSeed: client,
+			nonce:      1,
+			want:       lottery.Pair{126, 132},
+		},
+		{
+			name:       "no client seed",
+			serverSeed: seed,
+			nonce:      0,
+			want:       lottery.Pair{149, 58},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Draw(tt.serverSeed, tt.clientSeed, tt.nonce); got != tt.want {
+				t.Errorf("Draw() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	seed, err := NewSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := Commit(seed)
+
+	if !Verify(seed, commit) {
+		t.Errorf("Verify() of committed seed failed")
+	}
+
+	seed[0] ^= 1
+	if Verify(seed, commit) {
+		t.Errorf("Verify() of another seed succeeded")
+	}
+}
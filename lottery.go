@@ -1,7 +1,11 @@
 package lottery
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -13,11 +17,54 @@ func (p Pair) String() string {
 	return fmt.Sprintf("%d:%d", p[0], p[1])
 }
 
+// MarshalJSON encodes pair as a "a:b" JSON string
+func (p Pair) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON decodes pair from a "a:b" JSON string
+func (p *Pair) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	res, err := ParsePair(s)
+	if err != nil {
+		return err
+	}
+	*p = res
+	return nil
+}
+
+// ParsePair parses pair from "a:b" string, where a and b are decimal numbers
+// in range 0-255. It's the inverse of Pair.String
+func ParsePair(s string) (Pair, error) {
+	var p Pair
+
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return p, fmt.Errorf("invalid pair: '%s'", s)
+	}
+
+	a, err := strconv.ParseUint(s[:i], 10, 8)
+	if err != nil {
+		return p, fmt.Errorf("invalid pair: '%s'", s)
+	}
+	b, err := strconv.ParseUint(s[i+1:], 10, 8)
+	if err != nil {
+		return p, fmt.Errorf("invalid pair: '%s'", s)
+	}
+
+	p[0], p[1] = byte(a), byte(b)
+	return p, nil
+}
+
 // Request is a client request message to the lottery game server
 type Request struct {
-	UUID  uuid.UUID
-	Fee   uint64
-	Guess Pair
+	UUID  uuid.UUID `json:"uuid"`
+	Fee   uint64    `json:"fee"`
+	Guess Pair      `json:"guess"`
 }
 
 func (r Request) String() string {
@@ -33,6 +80,7 @@ const (
 	NoWin ResponseType = iota
 	Win
 	Bonus
+	Error
 )
 
 func (t ResponseType) String() string {
@@ -43,22 +91,149 @@ func (t ResponseType) String() string {
 		return "win"
 	case Bonus:
 		return "bonus"
+	case Error:
+		return "error"
 	default:
 		return "unknown"
 	}
 }
 
+// MarshalJSON encodes response type as a JSON string
+func (t ResponseType) MarshalJSON() ([]byte, error) {
+	switch t {
+	case NoWin:
+		return []byte(`"nowin"`), nil
+	case Win:
+		return []byte(`"win"`), nil
+	case Bonus:
+		return []byte(`"bonus"`), nil
+	case Error:
+		return []byte(`"error"`), nil
+	default:
+		return nil, fmt.Errorf("invalid response type: '%d'", t)
+	}
+}
+
+// UnmarshalJSON decodes response type from a JSON string
+func (t *ResponseType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	switch s {
+	case "nowin":
+		*t = NoWin
+	case "win":
+		*t = Win
+	case "bonus":
+		*t = Bonus
+	case "error":
+		*t = Error
+	default:
+		return fmt.Errorf("invalid response type: '%s'", s)
+	}
+	return nil
+}
+
+// ErrorCode is a reason of an Error response
+type ErrorCode uint8
+
+// Error codes
+const (
+	CodeUnknown ErrorCode = iota
+	CodeInternal
+	CodeBadRequest
+	CodeUnauthorized
+	CodeUnavailable
+	CodeRejected
+)
+
+func (c ErrorCode) String() string {
+	switch c {
+	case CodeInternal:
+		return "internal error"
+	case CodeBadRequest:
+		return "bad request"
+	case CodeUnauthorized:
+		return "unauthorized"
+	case CodeUnavailable:
+		return "service unavailable"
+	case CodeRejected:
+		return "play rejected"
+	default:
+		return "unknown error"
+	}
+}
+
+// CommitLen is the length of a provably fair server seed commitment
+const CommitLen = 32
+
+// MaxMessageLen is the maximum length of an error message. Longer messages
+// are truncated by encoders
+const MaxMessageLen = 255
+
 // Response is a server response message to the client
 type Response struct {
-	Type    ResponseType
-	Jackpot uint64
+	Type    ResponseType `json:"type"`
+	Jackpot uint64       `json:"jackpot,omitempty"`
+	// Error details, only set for Error responses
+	Code    ErrorCode `json:"code,omitempty"`
+	Message string    `json:"message,omitempty"`
+	// UUID of the request and the winning pair drawn for it. They aren't
+	// carried by the base wire formats, see encoding/signed
+	UUID uuid.UUID `json:"-"`
+	Draw Pair      `json:"-"`
+	// Commitment of the server seed and nonce of a provably fair draw, see
+	// package fair. Commit is zero for other draws. Carried by
+	// encoding/signed only
+	Commit [CommitLen]byte `json:"-"`
+	Nonce  uint64          `json:"-"`
+}
+
+// NewErrorResponse creates an Error response describing err. Details of errors
+// other than *ServerError are not exposed to the client
+func NewErrorResponse(err error) *Response {
+	var se *ServerError
+	if !errors.As(err, &se) {
+		se = &ServerError{Code: CodeInternal}
+	}
+
+	msg := se.Message
+	if len(msg) > MaxMessageLen {
+		msg = msg[:MaxMessageLen]
+	}
+	return &Response{Type: Error, Code: se.Code, Message: msg}
+}
+
+// Err returns *ServerError for Error responses and nil otherwise
+func (r Response) Err() error {
+	if r.Type != Error {
+		return nil
+	}
+	return &ServerError{Code: r.Code, Message: r.Message}
 }
 
 func (r Response) String() string {
 	switch r.Type {
 	case Win:
 		return fmt.Sprintf("%s: %d", r.Type, r.Jackpot)
+	case Error:
+		return fmt.Sprintf("%s: %s", r.Type, r.Err())
 	default:
 		return r.Type.String()
 	}
 }
+
+// ServerError is an error reported by the server in an Error response
+type ServerError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	if e.Message == "" {
+		return e.Code.String()
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
@@ -0,0 +1,45 @@
+package lottery
+
+import "testing"
+
+func TestParsePair(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Pair
+		wantErr bool
+	}{
+		{name: "zero", s: "0:0", want: Pair{0, 0}},
+		{name: "max", s: "255:255", want: Pair{255, 255}},
+		{name: "mixed", s: "12:200", want: Pair{12, 200}},
+		{name: "leading zeros", s: "012:007", want: Pair{12, 7}},
+		{name: "out of range", s: "256:1", wantErr: true},
+		{name: "negative", s: "-1:1", wantErr: true},
+		{name: "plus", s: "+1:1", wantErr: true},
+		{name: "no colon", s: "12", wantErr: true},
+		{name: "no second", s: "12:", wantErr: true},
+		{name: "no first", s: ":12", wantErr: true},
+		{name: "spaces", s: "1: 2", wantErr: true},
+		{name: "empty", s: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePair(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePair() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && got != tt.want {
+				t.Errorf("ParsePair() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPair_String(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		p := Pair{byte(i), byte(255 - i)}
+		got, err := ParsePair(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParsePair(%s) = %v, %v", p, got, err)
+		}
+	}
+}